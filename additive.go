@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+type AdditiveSynth struct {
+	amps   []float64 // partial amplitudes
+	ratios []float64 // partial frequencies relative to the note
+	decays []float64 // partial decay times in seconds, 0 = no decay
+	note   float64   // key of the first note character
+	adsr   ADSR
+	gain   float64
+}
+
+// extend repeats the last value of values until it has n elements
+func extend(values []float64, n int) []float64 {
+	for len(values) < n {
+		values = append(values, values[len(values)-1])
+	}
+	return values
+}
+
+func additiveSynthFactory(args string) (Processor, error) {
+	a := parseArgs(args, "partials", "decays", "ratios", "note", "attack", "decay", "sustain", "release", "gain")
+	s := &AdditiveSynth{
+		amps:   a.Floats("partials", []float64{1}),
+		decays: a.Floats("decays", []float64{0}),
+		note:   a.Key("note", 60),
+		adsr: ADSR{
+			Attack:  a.Float("attack", 0.005),
+			Decay:   a.Float("decay", 0.1),
+			Sustain: a.Float("sustain", 0.7),
+			Release: a.Float("release", 0.1),
+		},
+		gain: a.Float("gain", 0.5),
+	}
+	ratios := a.Floats("ratios", nil)
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	if len(ratios) > len(s.amps) {
+		return nil, fmt.Errorf("more ratios than partials")
+	}
+	for k := len(ratios); k < len(s.amps); k++ {
+		ratios = append(ratios, float64(k+1))
+	}
+	s.ratios = ratios
+	s.decays = extend(s.decays, len(s.amps))
+	sum := 0.0
+	for _, amp := range s.amps {
+		sum += math.Abs(amp)
+	}
+	if sum > 0 {
+		s.gain /= sum
+	}
+	return s, nil
+}
+
+func (s *AdditiveSynth) Process(t *Track, buf SampleBuffer) {
+	renderNotes(buf, t.Notes(s.note), func(n Note) Voice {
+		freq := noteFreq(n.Key)
+		v := &additiveVoice{
+			env:  NewEnvelope(s.adsr),
+			gain: s.gain * n.Velocity,
+		}
+		for k, amp := range s.amps {
+			p := partial{
+				inc:  freq * s.ratios[k] / float64(sr),
+				amp:  amp,
+				fade: 1,
+			}
+			if p.inc >= 0.5 {
+				continue
+			}
+			if s.decays[k] > 0 {
+				p.fade = math.Exp(-1 / (s.decays[k] * float64(sr)))
+			}
+			v.partials = append(v.partials, p)
+		}
+		return v
+	})
+}
+
+type partial struct {
+	phase float64
+	inc   float64
+	amp   float64
+	fade  float64 // per-frame amplitude multiplier
+}
+
+type additiveVoice struct {
+	partials []partial
+	env      *Envelope
+	gain     float64
+}
+
+func (v *additiveVoice) Next(gate bool) (l, r float64) {
+	out := 0.0
+	for i := range v.partials {
+		p := &v.partials[i]
+		out += math.Sin(2*math.Pi*p.phase) * p.amp
+		p.amp *= p.fade
+		p.phase += p.inc
+		p.phase -= math.Floor(p.phase)
+	}
+	out *= v.env.Next(gate) * v.gain
+	return out, out
+}
+
+func (v *additiveVoice) Done() bool {
+	return v.env.Done()
+}
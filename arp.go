@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Arp is an arpeggiator playing the notes held on a step one after
+// another instead of together.
+type Arp struct {
+	mode    string  // up, down, updown or random
+	octaves int     // number of octaves the notes are repeated in
+	rate    float64 // length of the arpeggiated notes (steps)
+}
+
+// arpeggiator of the tracks, nil for none
+var arp *Arp
+
+var arpModes = []string{"up", "down", "updown", "random"}
+
+func parseArp(args string) (*Arp, error) {
+	a := parseArgs(args, "mode", "octaves", "rate")
+	p := &Arp{
+		mode:    a.String("mode", "up"),
+		octaves: a.Int("octaves", 1),
+		rate:    a.Float("rate", 1),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(arpModes, p.mode) {
+		return nil, fmt.Errorf("unknown arp mode: %s", p.mode)
+	}
+	if p.octaves < 1 {
+		return nil, fmt.Errorf("invalid arp octaves: %d", p.octaves)
+	}
+	if p.rate <= 0 {
+		return nil, fmt.Errorf("invalid arp rate: %g", p.rate)
+	}
+	return p, nil
+}
+
+// sequence returns the keys of a chord in the order they are played
+func (p *Arp) sequence(keys []float64) []float64 {
+	slices.Sort(keys)
+	var seq []float64
+	for o := range p.octaves {
+		for _, key := range keys {
+			seq = append(seq, key+float64(12*o))
+		}
+	}
+	switch p.mode {
+	case "down":
+		slices.Reverse(seq)
+	case "updown":
+		for i := len(seq) - 2; i > 0; i-- {
+			seq = append(seq, seq[i])
+		}
+	}
+	return seq
+}
+
+// Apply replaces the notes starting together by notes of rate steps
+// cycling through their keys for as long as they are held.
+func (p *Arp) Apply(t *Track, notes []Note) []Note {
+	var out []Note
+	for i := 0; i < len(notes); {
+		j := i + 1
+		for j < len(notes) && notes[j].Start == notes[i].Start {
+			j++
+		}
+		first := notes[i]
+		var keys []float64
+		for _, n := range notes[i:j] {
+			keys = append(keys, n.Key)
+		}
+		seq := p.sequence(keys)
+		frames := max(int(p.rate*float64(t.StepFrames(first.Step))), 1)
+		end := first.Start + first.Length
+		if first.Stop > 0 {
+			end = min(end, first.Stop)
+		}
+		for k, start := 0, first.Start; start < end; k, start = k+1, start+frames {
+			n := first
+			n.Start = start
+			n.Length = min(frames, end-start)
+			if p.mode == "random" {
+				n.Key = seq[t.rng.Intn(len(seq))]
+			} else {
+				n.Key = seq[k%len(seq)]
+			}
+			out = append(out, n)
+		}
+		i = j
+	}
+	return out
+}
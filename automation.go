@@ -0,0 +1,78 @@
+package main
+
+import "math"
+
+// AutomationLine is the data of an automation line (~name) or parameter
+// lock line (!name) binding hex digits to a processor parameter. Digits
+// map 0..f to the range low..high, given in the line or by the
+// processor.
+type AutomationLine struct {
+	data      string
+	low, high float64
+	ranged    bool // whether the line sets the range
+}
+
+// Param is the value of a processor parameter over a track: constant,
+// following an automation line, and overridden on the steps locked by
+// a parameter lock line.
+type Param struct {
+	value     float64
+	lane      *Lane
+	low, high float64
+	locks     []float64 // value locked on each step, NaN if not locked
+	starts    []int     // first frames of the steps
+}
+
+// Param returns parameter name of a processor whose static value is
+// value. Automation and lock lines without a range use low..high.
+func (t *Track) Param(name string, value, low, high float64) *Param {
+	p := &Param{
+		value:  value,
+		low:    low,
+		high:   high,
+		starts: t.stepStarts(),
+	}
+	if line, ok := t.automation[name]; ok {
+		if line.ranged {
+			p.low, p.high = line.low, line.high
+		}
+		def := 0.0
+		if p.high != p.low {
+			def = (value - p.low) / (p.high - p.low)
+		}
+		p.lane = newLane(line.data, p.starts, def)
+	}
+	if line, ok := t.locks[name]; ok {
+		if line.ranged {
+			low, high = line.low, line.high
+		}
+		p.locks = make([]float64, t.steps)
+		tokens := stepTokens(line.data)
+		for i := range p.locks {
+			p.locks[i] = math.NaN()
+			if i < len(tokens) {
+				if d := hexDigit(tokens[i][0]); d != -1 {
+					p.locks[i] = low + (high-low)*float64(d)/15
+				}
+			}
+		}
+	}
+	return p
+}
+
+// At returns the value of the parameter at frame
+func (p *Param) At(frame int) float64 {
+	if i := stepAt(p.starts, frame); i < len(p.locks) && !math.IsNaN(p.locks[i]) {
+		return p.locks[i]
+	}
+	if p.lane == nil {
+		return p.value
+	}
+	return p.low + (p.high-p.low)*p.lane.At(frame)
+}
+
+// Step returns the value of the parameter at the start of step i, for
+// parameters taken once when a note is triggered
+func (p *Param) Step(i int) float64 {
+	return p.At(p.starts[min(i, len(p.starts)-1)])
+}
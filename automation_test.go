@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestAutomationStepTokens(t *testing.T) {
+	track := testTrack()
+	track.steps = 4
+	// the multi-byte rest takes a single step
+	track.automation["cutoff"] = AutomationLine{data: "0·f."}
+	track.locks["cutoff"] = AutomationLine{data: "·f.."}
+	p := track.Param("cutoff", 0, 0, 15)
+	for i, want := range []float64{0, 0, 15, 15} {
+		if got := p.lane.values[i]; got != want/15 {
+			t.Errorf("lane step %d: got %g, want %g", i, got, want/15)
+		}
+	}
+	if got := p.Step(1); got != 15 {
+		t.Errorf("locked step 1: got %g, want 15", got)
+	}
+}
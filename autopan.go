@@ -0,0 +1,41 @@
+package main
+
+import (
+	"math"
+)
+
+// AutoPan moves the stereo image from side to side with a tempo-synced
+// LFO, using constant-power panning.
+type AutoPan struct {
+	period Duration // LFO period
+	depth  float64  // 0..1
+	lfo    *LFO
+}
+
+func autoPanFactory(args string) (Processor, error) {
+	a := parseArgs(args, "period", "depth", "wave")
+	wave, err := parseWaveform(a.String("wave", "sine"))
+	if err != nil {
+		return nil, err
+	}
+	p := &AutoPan{
+		period: a.Duration("period", "8"),
+		depth:  a.Float("depth", 1),
+		lfo:    NewLFO(wave, 0),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *AutoPan) Process(t *Track, buf SampleBuffer) {
+	p.lfo.Sync(t, p.period)
+	for i := 0; i < len(buf); i += nchannels {
+		pan := min(max(p.depth*p.lfo.Next(), -1), 1)
+		angle := (pan + 1) * math.Pi / 4
+		// gains are normalized so the center position is unity
+		buf[i] *= math.Cos(angle) * math.Sqrt2
+		buf[i+1] *= math.Sin(angle) * math.Sqrt2
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"math"
+)
+
+// AutoWah sweeps a resonant filter with the level of the signal.
+type AutoWah struct {
+	mode    FilterMode
+	cutoff  float64 // Hz at silence
+	depth   float64 // sweep range (octaves)
+	sens    float64 // envelope gain
+	res     float64 // 0..1
+	mix     float64 // dry/wet (0..1)
+	env     *Follower
+	filters [2]SVF
+}
+
+func autoWahFactory(args string) (Processor, error) {
+	a := parseArgs(args, "sens", "range", "res", "cutoff", "mode", "attack", "release", "mix")
+	mode, err := parseFilterMode(a.String("mode", "bp"))
+	if err != nil {
+		return nil, err
+	}
+	w := &AutoWah{
+		mode:   mode,
+		sens:   a.Float("sens", 4),
+		depth:  a.Float("range", 4),
+		res:    a.Float("res", 0.7),
+		cutoff: a.Float("cutoff", 300),
+		env:    NewFollower(a.Float("attack", 0.005), a.Float("release", 0.1)),
+		mix:    a.Float("mix", 1),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *AutoWah) Process(t *Track, buf SampleBuffer) {
+	for i := 0; i < len(buf); i += nchannels {
+		env := w.env.Next(max(math.Abs(buf[i]), math.Abs(buf[i+1])))
+		cutoff := w.cutoff * math.Pow(2, w.depth*min(env*w.sens, 1))
+		for c := range w.filters {
+			x := buf[i+c]
+			buf[i+c] = x*(1-w.mix) + w.filters[c].Filter(x, cutoff, w.res, w.mode)*w.mix
+		}
+	}
+}
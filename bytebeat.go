@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// bytebeatExpr is a compiled bytebeat expression of the time variable t
+type bytebeatExpr func(t int64) int64
+
+// bytebeat operators by precedence level, lowest first; longer
+// operators come first so they are matched before their prefixes
+var bytebeatLevels = [][]string{
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<=", ">=", "<", ">"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func bytebeatBinary(op string, a, b bytebeatExpr) bytebeatExpr {
+	bool2int := func(b bool) int64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	switch op {
+	case "|":
+		return func(t int64) int64 { return a(t) | b(t) }
+	case "^":
+		return func(t int64) int64 { return a(t) ^ b(t) }
+	case "&":
+		return func(t int64) int64 { return a(t) & b(t) }
+	case "==":
+		return func(t int64) int64 { return bool2int(a(t) == b(t)) }
+	case "!=":
+		return func(t int64) int64 { return bool2int(a(t) != b(t)) }
+	case "<=":
+		return func(t int64) int64 { return bool2int(a(t) <= b(t)) }
+	case ">=":
+		return func(t int64) int64 { return bool2int(a(t) >= b(t)) }
+	case "<":
+		return func(t int64) int64 { return bool2int(a(t) < b(t)) }
+	case ">":
+		return func(t int64) int64 { return bool2int(a(t) > b(t)) }
+	case "<<":
+		return func(t int64) int64 { return a(t) << (uint64(b(t)) & 63) }
+	case ">>":
+		return func(t int64) int64 { return a(t) >> (uint64(b(t)) & 63) }
+	case "+":
+		return func(t int64) int64 { return a(t) + b(t) }
+	case "-":
+		return func(t int64) int64 { return a(t) - b(t) }
+	case "*":
+		return func(t int64) int64 { return a(t) * b(t) }
+	case "/":
+		return func(t int64) int64 {
+			if d := b(t); d != 0 {
+				return a(t) / d
+			}
+			return 0
+		}
+	case "%":
+		return func(t int64) int64 {
+			if d := b(t); d != 0 {
+				return a(t) % d
+			}
+			return 0
+		}
+	}
+	panic("unknown bytebeat operator: " + op)
+}
+
+type bytebeatParser struct {
+	src string
+	pos int
+}
+
+func (p *bytebeatParser) skipSpace() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *bytebeatParser) accept(op string) bool {
+	p.skipSpace()
+	if !strings.HasPrefix(p.src[p.pos:], op) {
+		return false
+	}
+	p.pos += len(op)
+	return true
+}
+
+func (p *bytebeatParser) parseLevel(level int) (bytebeatExpr, error) {
+	if level == len(bytebeatLevels) {
+		return p.parseUnary()
+	}
+	left, err := p.parseLevel(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		matched := ""
+		for _, op := range bytebeatLevels[level] {
+			if p.accept(op) {
+				matched = op
+				break
+			}
+		}
+		if matched == "" {
+			return left, nil
+		}
+		right, err := p.parseLevel(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = bytebeatBinary(matched, left, right)
+	}
+}
+
+func (p *bytebeatParser) parseUnary() (bytebeatExpr, error) {
+	switch {
+	case p.accept("-"):
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(t int64) int64 { return -e(t) }, nil
+	case p.accept("~"):
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(t int64) int64 { return ^e(t) }, nil
+	case p.accept("("):
+		e, err := p.parseLevel(0)
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("missing ) at position %d", p.pos)
+		}
+		return e, nil
+	case p.accept("t"):
+		return func(t int64) int64 { return t }, nil
+	}
+	start := p.pos
+	for p.pos < len(p.src) && (unicode.IsDigit(rune(p.src[p.pos])) || strings.IndexByte("xXabcdefABCDEF", p.src[p.pos]) != -1) {
+		p.pos++
+	}
+	if start == p.pos {
+		return nil, fmt.Errorf("unexpected input at position %d", p.pos)
+	}
+	n, err := strconv.ParseInt(p.src[start:p.pos], 0, 64)
+	if err != nil {
+		return nil, err
+	}
+	return func(t int64) int64 { return n }, nil
+}
+
+// parseBytebeat compiles a C-like integer expression of t
+func parseBytebeat(src string) (bytebeatExpr, error) {
+	p := &bytebeatParser{src: src}
+	e, err := p.parseLevel(0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bytebeat expression: %s: %w", src, err)
+	}
+	p.skipSpace()
+	if p.pos != len(src) {
+		return nil, fmt.Errorf("invalid bytebeat expression: %s: unexpected input at position %d", src, p.pos)
+	}
+	return e, nil
+}
+
+// Bytebeat renders an expression evaluated once per tick, taking the low
+// byte of the result as an unsigned 8-bit sample. Ticks advance at rate
+// per second when the track plays at bpm, faster or slower at other
+// tempos.
+type Bytebeat struct {
+	expr bytebeatExpr
+	rate float64 // ticks per second
+	bpm  float64 // tempo at which rate applies
+	gain float64
+}
+
+func bytebeatFactory(args string) (Processor, error) {
+	a := parseArgs(args, "expr", "rate", "bpm", "gain")
+	src := a.String("expr", "t")
+	b := &Bytebeat{
+		rate: a.Float("rate", 8000),
+		bpm:  a.Float("bpm", 120),
+		gain: a.Float("gain", 0.3),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	expr, err := parseBytebeat(src)
+	if err != nil {
+		return nil, err
+	}
+	b.expr = expr
+	return b, nil
+}
+
+func (b *Bytebeat) Process(t *Track, buf SampleBuffer) {
+	frames := min(t.Frames(), len(buf)/nchannels)
+	rate := b.rate * t.bpm / b.bpm / float64(sr)
+	var dc DCBlocker
+	for i := 0; i < frames; i++ {
+		tick := int64(float64(i) * rate)
+		out := dc.Process(float64(b.expr(tick)&255)/128-1) * b.gain
+		buf[i*nchannels] += out
+		buf[i*nchannels+1] += out
+	}
+}
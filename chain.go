@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Chain is an instrument followed by insert effects. The instrument is
+// rendered on a buffer of its own, so that the effects process only its
+// output, which is then added to the pattern buffer. A chain of effects
+// processes the pattern buffer in place.
+type Chain struct {
+	procs   []Processor
+	buf     SampleBuffer
+	inPlace bool
+}
+
+// processors transforming the buffer instead of adding to it
+var effectNames = map[string]bool{
+	"ringmod": true, "delay": true, "reverb": true, "filter": true,
+	"eq": true, "comp": true, "dist": true, "crush": true, "chorus": true,
+	"flanger": true, "phaser": true, "trem": true, "vibrato": true,
+	"autopan": true, "width": true, "tape": true, "gate": true,
+	"pitch": true, "stutter": true, "vocoder": true, "autowah": true,
+	"graindelay": true, "shimmer": true, "mbcomp": true, "transient": true,
+	"exciter": true,
+}
+
+// chainFactory returns a factory instantiating factory followed by the
+// effects given as name:args specs; inPlace tells whether factory makes
+// an effect
+func chainFactory(factory ProcessorFactory, specs []string, inPlace bool) ProcessorFactory {
+	return func(args string) (Processor, error) {
+		proc, err := factory(args)
+		if err != nil {
+			return nil, err
+		}
+		c := &Chain{procs: []Processor{proc}, inPlace: inPlace}
+		for _, spec := range specs {
+			name, args, _ := strings.Cut(spec, ":")
+			factory, ok := processorFactories[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown processor: %s", name)
+			}
+			proc, err := withDefaults(name, factory)(args)
+			if err != nil {
+				return nil, fmt.Errorf("cannot instantiate processor %s: %v", name, err)
+			}
+			c.procs = append(c.procs, proc)
+		}
+		return c, nil
+	}
+}
+
+func (c *Chain) Refs() []string {
+	var refs []string
+	for _, proc := range c.procs {
+		if r, ok := proc.(Referrer); ok {
+			refs = append(refs, r.Refs()...)
+		}
+	}
+	return refs
+}
+
+func (c *Chain) Process(t *Track, buf SampleBuffer) {
+	if c.inPlace {
+		for _, proc := range c.procs {
+			proc.Process(t, buf)
+		}
+		return
+	}
+	if len(c.buf) != len(buf) {
+		c.buf = make(SampleBuffer, len(buf))
+	} else {
+		c.buf.Clear()
+	}
+	for _, proc := range c.procs {
+		proc.Process(t, c.buf)
+	}
+	for i := range buf {
+		buf[i] += c.buf[i]
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// constProc adds a constant to the buffer
+type constProc float64
+
+func (p constProc) Process(t *Track, buf SampleBuffer) {
+	for i := range buf {
+		buf[i] += float64(p)
+	}
+}
+
+func TestChainProcessesInstrumentOutput(t *testing.T) {
+	track := testTrack()
+	instrument := func(args string) (Processor, error) { return constProc(1), nil }
+	filter, err := filterFactory("mode=lp:cutoff=200")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the filtered instrument added to what the buffer held
+	want := NewSampleBuffer(4800)
+	constProc(1).Process(track, want)
+	filter.Process(track, want)
+	constProc(0.25).Process(track, want)
+	chain, err := chainFactory(instrument, []string{"filter:mode=lp:cutoff=200"}, false)("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := NewSampleBuffer(4800)
+	constProc(0.25).Process(track, buf)
+	chain.Process(track, buf)
+	for i := range want {
+		if d := buf[i] - want[i]; d > 1e-9 || d < -1e-9 {
+			t.Fatalf("sample %d: got %g, want %g", i, buf[i], want[i])
+		}
+	}
+}
+
+func TestChainOfEffectsProcessesInPlace(t *testing.T) {
+	// a mono signal, which width leaves unchanged
+	rng := rand.New(rand.NewSource(1))
+	input := NewSampleBuffer(4800)
+	for i := 0; i < len(input); i += nchannels {
+		input[i] = rng.Float64()*2 - 1
+		input[i+1] = input[i]
+	}
+	render := func(factory ProcessorFactory) SampleBuffer {
+		proc, err := factory("mode=lp:cutoff=200")
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := slices.Clone(input)
+		proc.Process(testTrack(), buf)
+		return buf
+	}
+	single := render(filterFactory)
+	chained := render(chainFactory(filterFactory, []string{"width"}, true))
+	if slices.Equal(single, input) {
+		t.Fatal("filter left the signal unchanged")
+	}
+	for i := range single {
+		if d := chained[i] - single[i]; d > 1e-9 || d < -1e-9 {
+			t.Fatalf("sample %d: chained %g, single %g", i, chained[i], single[i])
+		}
+	}
+}
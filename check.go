@@ -0,0 +1,108 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// whether problems in song files are errors by default rather than
+// warnings, set from the command line
+var strictMode bool
+
+// matches a line starting with a word, which may be a misspelt directive
+var directiveLikePattern = regexp.MustCompile(`^([A-Za-z]{3,})(?:\s|$)`)
+
+// names of the directives checked for misspellings
+var directiveNames = []string{
+	"arp", "arrange", "bpm", "define", "defaults", "deftrack", "fine",
+	"goto", "groove", "humanize", "include", "key", "label", "lenient",
+	"let", "limiter", "map", "mute", "repeat", "seed", "segno", "solo",
+	"step", "steps", "strict", "strum", "swing", "tocoda", "transpose",
+	"tuning",
+}
+
+// unknownDirective returns the first word of a line which would be
+// taken as a data line but is close to the name of a directive
+func unknownDirective(line string) (string, bool) {
+	m := directiveLikePattern.FindStringSubmatch(line)
+	if m == nil {
+		return "", false
+	}
+	word := strings.ToLower(m[1])
+	for _, name := range directiveNames {
+		// allow a single typo in short names
+		maxDistance := 1
+		if len(name) > 5 {
+			maxDistance = 2
+		}
+		if editDistance(word, name) <= maxDistance {
+			return m[1], true
+		}
+	}
+	return "", false
+}
+
+// editDistance returns the number of insertions, deletions,
+// substitutions and transpositions of adjacent letters turning a into b
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+// Data returns data line code of the track, noting that its processor
+// reads it
+func (t *Track) Data(code rune) string {
+	t.used[code] = true
+	return t.data[code]
+}
+
+// dataWidth returns the number of steps of data line code
+func (t *Track) dataWidth(code rune) int {
+	width := 0
+	for _, token := range t.noteTokens(t.data[code]) {
+		width += stepWidth(token, t.noteTokens)
+	}
+	return width
+}
+
+// dataCodes returns the codes of the data lines of the track in order
+func (t *Track) dataCodes() []rune {
+	var codes []rune
+	for code := range t.data {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	return codes
+}
+
+// unusedCodes returns the codes of the data lines which the processor
+// of the track didn't read when rendering it
+func (t *Track) unusedCodes() []rune {
+	var codes []rune
+	for _, code := range t.dataCodes() {
+		if !t.used[code] {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
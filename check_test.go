@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestUnknownDirective(t *testing.T) {
+	for _, test := range []struct {
+		line string
+		want bool
+	}{
+		{"bmp 120", true},
+		{"tempo 120", false},
+		{"swign 60", true},
+		{"tranpsose 2", true},
+		{"nace", false},
+		{"vxxx", false},
+		{"xxxx", false},
+		{"n C4..E4..", false},
+		{"deflauts filter cutoff=200", true},
+	} {
+		if _, got := unknownDirective(test.line); got != test.want {
+			t.Errorf("%q: got %v, want %v", test.line, got, test.want)
+		}
+	}
+}
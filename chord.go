@@ -0,0 +1,109 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// intervals of chord qualities (semitones above the root)
+var chordQualities = map[string][]float64{
+	"":     {0, 4, 7},
+	"maj":  {0, 4, 7},
+	"m":    {0, 3, 7},
+	"min":  {0, 3, 7},
+	"dim":  {0, 3, 6},
+	"aug":  {0, 4, 8},
+	"sus2": {0, 2, 7},
+	"sus4": {0, 5, 7},
+	"6":    {0, 4, 7, 9},
+	"m6":   {0, 3, 7, 9},
+	"7":    {0, 4, 7, 10},
+	"maj7": {0, 4, 7, 11},
+	"m7":   {0, 3, 7, 10},
+	"m7b5": {0, 3, 6, 10},
+	"dim7": {0, 3, 6, 9},
+	"9":    {0, 4, 7, 10, 14},
+	"add9": {0, 4, 7, 14},
+}
+
+var (
+	chordRootPattern   = regexp.MustCompile(`^([A-G][#b]?)(.*)$`)
+	chordOctavePattern = regexp.MustCompile(`^-?[0-9]$`)
+)
+
+// chord qualities, longest first so that the digits of a quality aren't
+// taken for an octave
+var chordQualityNames = slices.SortedFunc(maps.Keys(chordQualities), func(a, b string) int {
+	return cmp.Or(cmp.Compare(len(b), len(a)), cmp.Compare(a, b))
+})
+
+// parseChord returns the keys of a chord like Am, Cmaj7 or F#m7b5. With
+// an octave after the quality (Am3, Cmaj73) the chord is in root position
+// from that octave, otherwise it is voiced in the octave above base,
+// inverted as needed, with extensions beyond the octave on top. Digits
+// belong to the quality where they can, so C7 is a seventh chord.
+func parseChord(s string, base float64) ([]float64, error) {
+	matches := chordRootPattern.FindStringSubmatch(s)
+	if matches == nil {
+		return nil, fmt.Errorf("invalid chord: %s", s)
+	}
+	var intervals []float64
+	octave := ""
+	found := false
+	for _, quality := range chordQualityNames {
+		rest, ok := strings.CutPrefix(matches[2], quality)
+		if ok && (rest == "" || chordOctavePattern.MatchString(rest)) {
+			intervals, octave, found = chordQualities[quality], rest, true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("unknown chord quality: %s", s)
+	}
+	explicit := octave != ""
+	if !explicit {
+		octave = "4"
+	}
+	root, err := parseNoteName(matches[1] + octave)
+	if err != nil {
+		return nil, err
+	}
+	var keys []float64
+	for _, interval := range intervals {
+		if explicit {
+			keys = append(keys, root+interval)
+			continue
+		}
+		// move simple intervals into the octave above base
+		key := base + math.Mod(math.Mod(root+interval-base, 12)+12, 12)
+		if interval >= 12 {
+			key = base + 12 + math.Mod(math.Mod(root+interval-base, 12)+12, 12)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// checkChords returns the error of the first invalid chord in a data
+// line, which would otherwise play as a rest
+func checkChords(data string) error {
+	for _, token := range stepTokens(data) {
+		if inner, _, ok := tuplet(token, stepTokens); ok {
+			if err := checkChords(strings.Join(inner, "")); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(token) > 2 && token[0] == '{' && token[len(token)-1] == '}' {
+			if _, err := parseChord(token[1:len(token)-1], 60); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseChord(t *testing.T) {
+	for _, test := range []struct {
+		chord string
+		keys  []float64
+	}{
+		{"C", []float64{60, 64, 67}},
+		{"Am", []float64{69, 60, 64}},
+		{"F#m", []float64{66, 69, 61}},
+		{"Cmaj7", []float64{60, 64, 67, 71}},
+		{"Am7", []float64{69, 60, 64, 67}},
+		{"C7", []float64{60, 64, 67, 70}},
+		{"Cm7b5", []float64{60, 63, 66, 70}},
+		{"Cadd9", []float64{60, 64, 67, 74}},
+		{"Cmaj73", []float64{48, 52, 55, 59}},
+		{"Am3", []float64{57, 60, 64}},
+	} {
+		keys, err := parseChord(test.chord, 60)
+		if err != nil {
+			t.Errorf("%s: %v", test.chord, err)
+			continue
+		}
+		if !slices.Equal(keys, test.keys) {
+			t.Errorf("%s: got %v, want %v", test.chord, keys, test.keys)
+		}
+	}
+}
+
+func TestParseChordInvalid(t *testing.T) {
+	for _, chord := range []string{"Cfoo", "H7", "Cmaj7x"} {
+		if _, err := parseChord(chord, 60); err == nil {
+			t.Errorf("%s: no error", chord)
+		}
+	}
+}
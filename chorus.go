@@ -0,0 +1,61 @@
+package main
+
+import (
+	"math"
+)
+
+// Chorus mixes several copies of the signal read from delay lines
+// modulated by LFOs of evenly distributed phase. Voices are panned
+// across the stereo field by spread.
+type Chorus struct {
+	voices int
+	rate   float64 // LFO rate (Hz)
+	delay  float64 // base delay (seconds)
+	depth  float64 // delay modulation (seconds)
+	spread float64 // stereo spread (0..1)
+	mix    float64 // dry/wet (0..1)
+	lines  [2]*DelayLine
+	phase  float64
+}
+
+func chorusFactory(args string) (Processor, error) {
+	a := parseArgs(args, "voices", "rate", "depth", "delay", "spread", "mix")
+	c := &Chorus{
+		voices: max(a.Int("voices", 3), 1),
+		rate:   a.Float("rate", 0.8),
+		depth:  a.Float("depth", 0.003),
+		delay:  a.Float("delay", 0.015),
+		spread: a.Float("spread", 1),
+		mix:    a.Float("mix", 0.5),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	frames := int((c.delay + c.depth) * float64(sr))
+	c.lines = [2]*DelayLine{NewDelayLine(frames + 1), NewDelayLine(frames + 1)}
+	return c, nil
+}
+
+func (c *Chorus) Process(t *Track, buf SampleBuffer) {
+	for i := 0; i < len(buf); i += nchannels {
+		c.lines[0].Write(buf[i])
+		c.lines[1].Write(buf[i+1])
+		var l, r float64
+		for v := 0; v < c.voices; v++ {
+			phase := c.phase + float64(v)/float64(c.voices)
+			delay := (c.delay + c.depth*math.Sin(2*math.Pi*phase)) * float64(sr)
+			pan := 0.0
+			if c.voices > 1 {
+				pan = c.spread * (2*float64(v)/float64(c.voices-1) - 1)
+			}
+			// read each voice from both channels, weighted by its position
+			x := c.lines[0].Read(delay)*(1-pan)/2 + c.lines[1].Read(delay)*(1+pan)/2
+			l += x * (1 - pan)
+			r += x * (1 + pan)
+		}
+		scale := 1 / float64(c.voices)
+		buf[i] = buf[i]*(1-c.mix) + l*scale*c.mix
+		buf[i+1] = buf[i+1]*(1-c.mix) + r*scale*c.mix
+		c.phase = math.Mod(c.phase+c.rate/float64(sr), 1)
+	}
+}
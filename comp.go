@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Compressor reduces the level of a signal above a threshold. The
+// detector follows the peak level with separate attack and release
+// times. It listens to the signal it compresses unless keyed from
+// another track.
+type Compressor struct {
+	key       string  // name of the sidechain track
+	threshold float64 // dB
+	ratio     float64
+	knee      float64 // dB
+	attack    float64 // seconds
+	release   float64 // seconds
+	makeup    float64 // dB
+	env       float64 // detector level (dB above threshold)
+}
+
+func parseCompressor(a *Args) Compressor {
+	return Compressor{
+		threshold: a.Float("threshold", -18),
+		ratio:     a.Float("ratio", 4),
+		knee:      a.Float("knee", 6),
+		attack:    a.Float("attack", 0.01),
+		release:   a.Float("release", 0.1),
+		makeup:    a.Float("makeup", 0),
+	}
+}
+
+// coeff returns the one-pole smoothing coefficient for time t
+func coeff(t float64) float64 {
+	if t <= 0 {
+		return 0
+	}
+	return math.Exp(-1 / (t * float64(sr)))
+}
+
+// Gain returns the linear gain to apply for the given detector input.
+func (c *Compressor) Gain(x float64) float64 {
+	level := 20 * math.Log10(max(math.Abs(x), 1e-9))
+	over := level - c.threshold
+	// soft knee gain reduction
+	var reduction float64
+	switch {
+	case over <= -c.knee/2:
+		reduction = 0
+	case over < c.knee/2:
+		reduction = (1 - 1/c.ratio) * (over + c.knee/2) * (over + c.knee/2) / (2 * c.knee)
+	default:
+		reduction = (1 - 1/c.ratio) * over
+	}
+	k := coeff(c.release)
+	if reduction > c.env {
+		k = coeff(c.attack)
+	}
+	c.env = reduction + k*(c.env-reduction)
+	return math.Pow(10, (c.makeup-c.env)/20)
+}
+
+func compFactory(args string) (Processor, error) {
+	a := parseArgs(args, "threshold", "ratio", "attack", "release", "makeup", "knee", "key")
+	c := parseCompressor(a)
+	c.key = a.String("key", "")
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	if c.ratio < 1 {
+		return nil, fmt.Errorf("invalid ratio value: %g", c.ratio)
+	}
+	return &c, nil
+}
+
+func (c *Compressor) Refs() []string {
+	if c.key == "" {
+		return nil
+	}
+	return []string{c.key}
+}
+
+func (c *Compressor) Process(t *Track, buf SampleBuffer) {
+	key := buf
+	if c.key != "" {
+		key = t.Tap(c.key)
+	}
+	for i := 0; i < len(buf); i += nchannels {
+		g := c.Gain(max(math.Abs(key[i]), math.Abs(key[i+1])))
+		buf[i] *= g
+		buf[i+1] *= g
+	}
+}
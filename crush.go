@@ -0,0 +1,52 @@
+package main
+
+import (
+	"math"
+)
+
+// Crusher reduces bit depth and sample rate. The bit depth can be swept
+// by an LFO whose period is given in musical time.
+type Crusher struct {
+	bits   float64
+	factor float64  // downsampling factor
+	depth  float64  // bit depth modulation (bits)
+	period Duration // modulation period
+	mix    float64  // dry/wet (0..1)
+	lfo    *LFO
+	phase  float64 // position within the current held sample
+	held   [2]float64
+}
+
+func crushFactory(args string) (Processor, error) {
+	a := parseArgs(args, "bits", "factor", "depth", "period", "mix")
+	c := &Crusher{
+		bits:   a.Float("bits", 8),
+		factor: a.Float("factor", 4),
+		depth:  a.Float("depth", 0),
+		period: a.Duration("period", "16"),
+		mix:    a.Float("mix", 1),
+		lfo:    NewLFO(Triangle, 0),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	c.phase = c.factor
+	return c, nil
+}
+
+func (c *Crusher) Process(t *Track, buf SampleBuffer) {
+	c.lfo.Sync(t, c.period)
+	for i := 0; i < len(buf); i += nchannels {
+		bits := max(c.bits-c.depth*(c.lfo.Next()+1)/2, 1)
+		levels := math.Pow(2, bits-1)
+		if c.phase += 1; c.phase >= c.factor {
+			c.phase -= max(c.factor, 1)
+			for ch := range c.held {
+				c.held[ch] = math.Round(buf[i+ch]*levels) / levels
+			}
+		}
+		for ch := range c.held {
+			buf[i+ch] = buf[i+ch]*(1-c.mix) + c.held[ch]*c.mix
+		}
+	}
+}
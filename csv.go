@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// matches data lines imported from CSV or TSV files like
+// @import drums.csv row=2 col=2
+var importPattern = regexp.MustCompile(`^@import\s+(\S+)((?:\s+\w+=\d+)*)$`)
+
+// importCSV returns the steps in a row of a CSV file (TSV if its
+// extension is .tsv), starting at a column; rows and columns count from
+// 1. Empty cells are rests and cells longer than a character become
+// step groups like [C#4].
+func importCSV(filename string, options string) (string, error) {
+	row, col := 1, 1
+	for _, option := range strings.Fields(options) {
+		name, value, _ := strings.Cut(option, "=")
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return "", fmt.Errorf("invalid import option: %s", option)
+		}
+		switch name {
+		case "row":
+			row = n
+		case "col":
+			col = n
+		default:
+			return "", fmt.Errorf("unknown import option: %s", name)
+		}
+	}
+	f, err := os.Open(songPath(filename))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	if strings.EqualFold(filepath.Ext(filename), ".tsv") {
+		r.Comma = '\t'
+	}
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", filename, err)
+	}
+	if row > len(records) {
+		return "", fmt.Errorf("%s: no row %d", filename, row)
+	}
+	var sb strings.Builder
+	for _, cell := range records[row-1][min(col-1, len(records[row-1])):] {
+		cell = strings.TrimSpace(cell)
+		switch utf8.RuneCountInString(cell) {
+		case 0:
+			sb.WriteByte('.')
+		case 1:
+			sb.WriteString(cell)
+		default:
+			sb.WriteString("[" + cell + "]")
+		}
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportCSV(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "steps.csv")
+	if err := os.WriteFile(filename, []byte("x,,C#4\nkick,x,x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		options, want string
+	}{
+		{"", "x.[C#4]"},
+		{"row=2 col=2", "xx"},
+	} {
+		steps, err := importCSV(filename, test.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if steps != test.want {
+			t.Errorf("%q: got %q, want %q", test.options, steps, test.want)
+		}
+	}
+	if _, err := importCSV(filename, "row=3"); err == nil {
+		t.Error("row=3: no error for a missing row")
+	}
+}
+
+func TestImportCSVKeepsMultibyteSteps(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "steps.csv")
+	if err := os.WriteFile(filename, []byte("x,·,,C#4\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	steps, err := importCSV(filename, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "x·.[C#4]"; steps != want {
+		t.Errorf("got %q, want %q", steps, want)
+	}
+}
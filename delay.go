@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Delay is a tempo-synced stereo feedback delay.
+type Delay struct {
+	time     Duration
+	feedback float64
+	mix      float64 // dry/wet (0..1)
+	pingpong bool    // feed each channel's echoes into the other one
+	lines    [2]*DelayLine
+}
+
+func delayFactory(args string) (Processor, error) {
+	a := parseArgs(args, "time", "feedback", "mix", "pingpong")
+	d := &Delay{
+		time:     a.Duration("time", "3"),
+		feedback: a.Float("feedback", 0.4),
+		mix:      a.Float("mix", 0.3),
+		pingpong: a.Int("pingpong", 0) != 0,
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	if math.Abs(d.feedback) >= 1 {
+		return nil, fmt.Errorf("invalid feedback value: %g", d.feedback)
+	}
+	return d, nil
+}
+
+func (d *Delay) Process(t *Track, buf SampleBuffer) {
+	frames := d.time.Frames(t)
+	for c := range d.lines {
+		if d.lines[c] == nil || len(d.lines[c].buf) < int(frames)+2 {
+			d.lines[c] = NewDelayLine(int(frames) + 1)
+		}
+	}
+	for i := 0; i < len(buf); i += nchannels {
+		l := d.lines[0].Read(frames)
+		r := d.lines[1].Read(frames)
+		inL, inR := buf[i], buf[i+1]
+		if d.pingpong {
+			d.lines[0].Write(inL + r*d.feedback)
+			d.lines[1].Write(inR + l*d.feedback)
+		} else {
+			d.lines[0].Write(inL + l*d.feedback)
+			d.lines[1].Write(inR + r*d.feedback)
+		}
+		buf[i] = inL*(1-d.mix) + l*d.mix
+		buf[i+1] = inR*(1-d.mix) + r*d.mix
+	}
+}
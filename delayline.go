@@ -0,0 +1,32 @@
+package main
+
+import (
+	"math"
+)
+
+// DelayLine is a circular buffer read at fractional delays.
+type DelayLine struct {
+	buf []float64
+	pos int // index of the next write
+}
+
+func NewDelayLine(frames int) *DelayLine {
+	return &DelayLine{buf: make([]float64, max(frames, 1)+2)}
+}
+
+func (d *DelayLine) Write(x float64) {
+	d.buf[d.pos] = x
+	d.pos = (d.pos + 1) % len(d.buf)
+}
+
+// Read returns the signal delay frames ago; a delay of 1 is the most
+// recently written value.
+func (d *DelayLine) Read(delay float64) float64 {
+	delay = min(max(delay, 1), float64(len(d.buf)-2))
+	i := int(math.Floor(delay))
+	frac := delay - float64(i)
+	n := len(d.buf)
+	a := d.buf[(d.pos-i+n)%n]
+	b := d.buf[(d.pos-i-1+n)%n]
+	return a + (b-a)*frac
+}
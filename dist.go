@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+type Curve int
+
+const (
+	SoftClip Curve = iota
+	HardClip
+	Tanh
+	Foldback
+)
+
+var curves = map[string]Curve{
+	"soft": SoftClip,
+	"hard": HardClip,
+	"tanh": Tanh,
+	"fold": Foldback,
+}
+
+func parseCurve(name string) (Curve, error) {
+	if curve, ok := curves[name]; ok {
+		return curve, nil
+	}
+	return SoftClip, fmt.Errorf("unknown distortion curve: %s", name)
+}
+
+// Shape applies the transfer curve to x
+func (c Curve) Shape(x float64) float64 {
+	switch c {
+	case HardClip:
+		return min(max(x, -1), 1)
+	case Tanh:
+		return math.Tanh(x)
+	case Foldback:
+		// reflect at ±1 until within range
+		x = math.Mod(x+1, 4)
+		if x < 0 {
+			x += 4
+		}
+		if x > 2 {
+			x = 4 - x
+		}
+		return x - 1
+	}
+	// cubic soft clipper
+	x = min(max(x, -1), 1)
+	return 1.5 * (x - x*x*x/3)
+}
+
+// Distortion is a waveshaper with input drive and output gain.
+type Distortion struct {
+	curve Curve
+	drive float64 // input gain
+	gain  float64 // output gain
+	mix   float64 // dry/wet (0..1)
+	dc    [2]DCBlocker
+}
+
+func distFactory(args string) (Processor, error) {
+	a := parseArgs(args, "curve", "drive", "gain", "mix")
+	curve, err := parseCurve(a.String("curve", "soft"))
+	if err != nil {
+		return nil, err
+	}
+	d := &Distortion{
+		curve: curve,
+		drive: a.Float("drive", 4),
+		gain:  a.Float("gain", 0.5),
+		mix:   a.Float("mix", 1),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *Distortion) Process(t *Track, buf SampleBuffer) {
+	for i := 0; i < len(buf); i += nchannels {
+		for c := 0; c < 2; c++ {
+			x := buf[i+c]
+			y := d.dc[c].Process(d.curve.Shape(x*d.drive)) * d.gain
+			buf[i+c] = x*(1-d.mix) + y*d.mix
+		}
+	}
+}
@@ -0,0 +1,458 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"unicode/utf8"
+)
+
+// Decay is an exponential decay from 1 towards 0.
+type Decay struct {
+	level float64
+	mul   float64
+}
+
+func NewDecay(seconds float64) *Decay {
+	d := &Decay{level: 1}
+	if seconds > 0 {
+		d.mul = math.Exp(-1 / (seconds * float64(sr)))
+	}
+	return d
+}
+
+func (d *Decay) Next() float64 {
+	level := d.level
+	d.level *= d.mul
+	return level
+}
+
+// Done reports whether the decay has fallen below audibility (-80 dB)
+func (d *Decay) Done() bool {
+	return d.level < 1e-4
+}
+
+type Kick struct {
+	freq   float64 // final pitch (Hz)
+	sweep  float64 // initial pitch (Hz)
+	pdecay float64 // pitch envelope decay (seconds)
+	decay  float64 // amplitude decay (seconds)
+	click  float64 // level of the click transient
+	gain   float64
+}
+
+func kickFactory(args string) (Processor, error) {
+	a := parseArgs(args, "freq", "sweep", "pdecay", "decay", "click", "gain")
+	k := &Kick{
+		freq:   a.Float("freq", 50),
+		sweep:  a.Float("sweep", 200),
+		pdecay: a.Float("pdecay", 0.04),
+		decay:  a.Float("decay", 0.4),
+		click:  a.Float("click", 0.3),
+		gain:   a.Float("gain", 0.8),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (k *Kick) Process(t *Track, buf SampleBuffer) {
+	freq := t.Param("freq", k.freq, 20, 200)
+	decay := t.Param("decay", k.decay, 0.05, 2)
+	renderNotes(buf, t.Triggers(triggerCode), func(n Note) Voice {
+		locked := *k
+		locked.freq, locked.decay = freq.Step(n.Step), decay.Step(n.Step)
+		return locked.voice(n.Velocity)
+	})
+}
+
+func (k *Kick) voice(velocity float64) Voice {
+	return &kickVoice{
+		kick:  k,
+		amp:   NewDecay(k.decay),
+		pitch: NewDecay(k.pdecay),
+		click: NewDecay(0.004),
+		gain:  k.gain * velocity,
+	}
+}
+
+type kickVoice struct {
+	kick  *Kick
+	phase float64
+	amp   *Decay
+	pitch *Decay
+	click *Decay
+	gain  float64
+}
+
+func (v *kickVoice) Next(gate bool) (l, r float64) {
+	freq := v.kick.freq + (v.kick.sweep-v.kick.freq)*v.pitch.Next()
+	out := math.Sin(2*math.Pi*v.phase) * v.amp.Next()
+	out += math.Sin(6*math.Pi*v.phase) * v.click.Next() * v.kick.click
+	v.phase += freq / float64(sr)
+	v.phase -= math.Floor(v.phase)
+	out *= v.gain
+	return out, out
+}
+
+func (v *kickVoice) Done() bool {
+	return v.amp.Done()
+}
+
+func (v *kickVoice) OneShot() {}
+
+// Noise is a cheap deterministic white noise source.
+type Noise struct {
+	state uint32
+}
+
+func (n *Noise) Next() float64 {
+	if n.state == 0 {
+		n.state = 2463534242
+	}
+	n.state ^= n.state << 13
+	n.state ^= n.state >> 17
+	n.state ^= n.state << 5
+	return float64(n.state)/(1<<31) - 1
+}
+
+type Snare struct {
+	tone   float64 // pitch of the body (Hz)
+	decay  float64 // noise decay (seconds)
+	snappy float64 // noise level relative to the body
+	gain   float64
+}
+
+func snareFactory(args string) (Processor, error) {
+	a := parseArgs(args, "tone", "decay", "snappy", "gain")
+	s := &Snare{
+		tone:   a.Float("tone", 180),
+		decay:  a.Float("decay", 0.15),
+		snappy: a.Float("snappy", 0.7),
+		gain:   a.Float("gain", 0.6),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Snare) Process(t *Track, buf SampleBuffer) {
+	tone := t.Param("tone", s.tone, 100, 400)
+	decay := t.Param("decay", s.decay, 0.02, 1)
+	renderNotes(buf, t.Triggers(triggerCode), func(n Note) Voice {
+		locked := *s
+		locked.tone, locked.decay = tone.Step(n.Step), decay.Step(n.Step)
+		return locked.voice(n.Velocity)
+	})
+}
+
+func (s *Snare) voice(velocity float64) Voice {
+	return &snareVoice{
+		snare: s,
+		body:  NewDecay(0.08),
+		amp:   NewDecay(s.decay),
+		gain:  s.gain * velocity,
+	}
+}
+
+type snareVoice struct {
+	snare  *Snare
+	phase  float64
+	noise  Noise
+	filter SVF
+	body   *Decay
+	amp    *Decay
+	gain   float64
+}
+
+func (v *snareVoice) Next(gate bool) (l, r float64) {
+	out := math.Sin(2*math.Pi*v.phase) * v.body.Next() * (1 - v.snare.snappy)
+	_, _, hp := v.filter.Process(v.noise.Next(), 1500, 0)
+	out += hp * v.amp.Next() * v.snare.snappy
+	v.phase += v.snare.tone / float64(sr)
+	v.phase -= math.Floor(v.phase)
+	out *= v.gain
+	return out, out
+}
+
+func (v *snareVoice) Done() bool {
+	return v.amp.Done() && v.body.Done()
+}
+
+func (v *snareVoice) OneShot() {}
+
+type Hat struct {
+	tone  float64 // high-pass cutoff (Hz)
+	decay float64 // seconds
+	gain  float64
+}
+
+func hatFactory(args string) (Processor, error) {
+	a := parseArgs(args, "decay", "tone", "gain")
+	h := &Hat{
+		decay: a.Float("decay", 0.05),
+		tone:  a.Float("tone", 7000),
+		gain:  a.Float("gain", 0.4),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *Hat) Process(t *Track, buf SampleBuffer) {
+	tone := t.Param("tone", h.tone, 2000, 12000)
+	decay := t.Param("decay", h.decay, 0.01, 1)
+	renderNotes(buf, t.Triggers(triggerCode), func(n Note) Voice {
+		locked := *h
+		locked.tone, locked.decay = tone.Step(n.Step), decay.Step(n.Step)
+		return locked.voice(n.Velocity)
+	})
+}
+
+func (h *Hat) voice(velocity float64) Voice {
+	return &hatVoice{
+		hat:  h,
+		amp:  NewDecay(h.decay),
+		gain: h.gain * velocity,
+	}
+}
+
+// ratios of the square oscillators giving hats their metallic ring
+var hatRatios = [6]float64{1, 1.342, 1.2312, 1.6532, 1.9523, 2.1523}
+
+type hatVoice struct {
+	hat    *Hat
+	phases [6]float64
+	noise  Noise
+	filter SVF
+	amp    *Decay
+	gain   float64
+}
+
+func (v *hatVoice) Next(gate bool) (l, r float64) {
+	metal := 0.0
+	for i, ratio := range hatRatios {
+		if v.phases[i] < 0.5 {
+			metal += 1
+		} else {
+			metal -= 1
+		}
+		v.phases[i] += 400 * ratio / float64(sr)
+		v.phases[i] -= math.Floor(v.phases[i])
+	}
+	in := metal/6*0.5 + v.noise.Next()*0.5
+	_, _, hp := v.filter.Process(in, v.hat.tone, 0.2)
+	out := hp * v.amp.Next() * v.gain
+	return out, out
+}
+
+func (v *hatVoice) Done() bool {
+	return v.amp.Done()
+}
+
+func (v *hatVoice) OneShot() {}
+
+type Clap struct {
+	tone  float64 // band-pass center (Hz)
+	decay float64 // tail decay (seconds)
+	gain  float64
+}
+
+func clapFactory(args string) (Processor, error) {
+	a := parseArgs(args, "decay", "tone", "gain")
+	c := &Clap{
+		decay: a.Float("decay", 0.2),
+		tone:  a.Float("tone", 1200),
+		gain:  a.Float("gain", 0.6),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Clap) Process(t *Track, buf SampleBuffer) {
+	tone := t.Param("tone", c.tone, 500, 3000)
+	decay := t.Param("decay", c.decay, 0.05, 1)
+	renderNotes(buf, t.Triggers(triggerCode), func(n Note) Voice {
+		locked := *c
+		locked.tone, locked.decay = tone.Step(n.Step), decay.Step(n.Step)
+		return locked.voice(n.Velocity)
+	})
+}
+
+func (c *Clap) voice(velocity float64) Voice {
+	return &clapVoice{
+		clap: c,
+		tail: NewDecay(c.decay),
+		gain: c.gain * velocity,
+	}
+}
+
+// length of each of the three initial clap bursts
+const clapBurst = 0.01
+
+type clapVoice struct {
+	clap   *Clap
+	age    int
+	noise  Noise
+	filter SVF
+	burst  *Decay
+	tail   *Decay
+	gain   float64
+}
+
+func (v *clapVoice) Next(gate bool) (l, r float64) {
+	burstFrames := int(clapBurst * float64(sr))
+	var amp float64
+	if v.age < 3*burstFrames {
+		if v.age%burstFrames == 0 {
+			v.burst = NewDecay(clapBurst / 3)
+		}
+		amp = v.burst.Next()
+	} else {
+		amp = v.tail.Next()
+	}
+	v.age++
+	_, bp, _ := v.filter.Process(v.noise.Next(), v.clap.tone, 0.5)
+	out := bp * amp * v.gain * 2
+	return out, out
+}
+
+func (v *clapVoice) Done() bool {
+	return v.age >= 3*int(clapBurst*float64(sr)) && v.tail.Done()
+}
+
+func (v *clapVoice) OneShot() {}
+
+type cowbellVoice struct {
+	phases [2]float64
+	filter SVF
+	amp    *Decay
+	gain   float64
+}
+
+func newCowbellVoice(decay, gain float64) Voice {
+	return &cowbellVoice{amp: NewDecay(decay), gain: gain}
+}
+
+func (v *cowbellVoice) Next(gate bool) (l, r float64) {
+	in := 0.0
+	for i, freq := range [2]float64{540, 800} {
+		if v.phases[i] < 0.5 {
+			in += 0.5
+		} else {
+			in -= 0.5
+		}
+		v.phases[i] += freq / float64(sr)
+		v.phases[i] -= math.Floor(v.phases[i])
+	}
+	_, bp, _ := v.filter.Process(in, 800, 0.6)
+	out := bp * v.amp.Next() * v.gain
+	return out, out
+}
+
+func (v *cowbellVoice) Done() bool {
+	return v.amp.Done()
+}
+
+func (v *cowbellVoice) OneShot() {}
+
+// data line codes of the drum kit instruments
+const drumCodes = "bshocwlmt"
+
+// names of the drum kit instruments by data line code, for mapping other
+// codes to them
+var drumNames = map[string]rune{
+	"kick":    'b',
+	"snare":   's',
+	"hat":     'h',
+	"openhat": 'o',
+	"clap":    'c',
+	"cowbell": 'w',
+	"lowtom":  'l',
+	"midtom":  'm',
+	"hitom":   't',
+}
+
+type DrumKit struct {
+	voices map[rune]func(velocity float64) Voice
+}
+
+func drumKitFactory(args string) (Processor, error) {
+	a := parseArgs(args, "kit", "gain")
+	kit := a.String("kit", "808")
+	gain := a.Float("gain", 1)
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	var bd, lt, mt, ht *Kick
+	var sd *Snare
+	var ch, oh *Hat
+	switch kit {
+	case "808":
+		bd = &Kick{freq: 48, sweep: 110, pdecay: 0.03, decay: 0.6, click: 0.1}
+		sd = &Snare{tone: 190, decay: 0.12, snappy: 0.5}
+		ch = &Hat{tone: 8000, decay: 0.04}
+		oh = &Hat{tone: 8000, decay: 0.3}
+		lt = &Kick{freq: 90, sweep: 110, pdecay: 0.05, decay: 0.3}
+		mt = &Kick{freq: 130, sweep: 160, pdecay: 0.05, decay: 0.25}
+		ht = &Kick{freq: 180, sweep: 220, pdecay: 0.05, decay: 0.2}
+	case "909":
+		bd = &Kick{freq: 55, sweep: 250, pdecay: 0.02, decay: 0.3, click: 0.5}
+		sd = &Snare{tone: 220, decay: 0.18, snappy: 0.75}
+		ch = &Hat{tone: 9000, decay: 0.05}
+		oh = &Hat{tone: 9000, decay: 0.4}
+		lt = &Kick{freq: 100, sweep: 180, pdecay: 0.03, decay: 0.25, click: 0.2}
+		mt = &Kick{freq: 145, sweep: 240, pdecay: 0.03, decay: 0.2, click: 0.2}
+		ht = &Kick{freq: 200, sweep: 320, pdecay: 0.03, decay: 0.18, click: 0.2}
+	default:
+		return nil, fmt.Errorf("unknown drum kit: %s", kit)
+	}
+	cp := &Clap{tone: 1200, decay: 0.2}
+	bd.gain, sd.gain, ch.gain, oh.gain, cp.gain = 0.8*gain, 0.6*gain, 0.3*gain, 0.3*gain, 0.6*gain
+	lt.gain, mt.gain, ht.gain = 0.6*gain, 0.6*gain, 0.6*gain
+	d := &DrumKit{
+		voices: map[rune]func(velocity float64) Voice{
+			'b': bd.voice,
+			's': sd.voice,
+			'h': ch.voice,
+			'o': oh.voice,
+			'c': cp.voice,
+			'w': func(velocity float64) Voice {
+				return newCowbellVoice(0.3, 0.5*gain*velocity)
+			},
+			'l': lt.voice,
+			'm': mt.voice,
+			't': ht.voice,
+		},
+	}
+	return d, nil
+}
+
+func (d *DrumKit) Process(t *Track, buf SampleBuffer) {
+	voices := maps.Clone(d.voices)
+	// codes mapped to instruments by name
+	for char, name := range t.charMap {
+		if c, ok := drumNames[name]; ok {
+			code, _ := utf8.DecodeRuneInString(char)
+			voices[code] = d.voices[c]
+		}
+	}
+	codes := []rune(drumCodes)
+	for _, code := range slices.Sorted(maps.Keys(voices)) {
+		if !slices.Contains(codes, code) {
+			codes = append(codes, code)
+		}
+	}
+	for _, code := range codes {
+		voice := voices[code]
+		renderNotes(buf, t.Triggers(code), func(n Note) Voice {
+			return voice(n.Velocity)
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// BiquadCoeffs holds normalized biquad filter coefficients.
+type BiquadCoeffs struct {
+	b0, b1, b2, a1, a2 float64
+}
+
+// Biquad is a direct form I biquad filter.
+type Biquad struct {
+	BiquadCoeffs
+	x1, x2, y1, y2 float64
+}
+
+func (f *Biquad) Process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// eqCoeffs computes the coefficients of an RBJ cookbook peaking or
+// shelving filter
+func eqCoeffs(kind string, freq, gainDB, q float64) (BiquadCoeffs, error) {
+	A := math.Pow(10, gainDB/40)
+	w := 2 * math.Pi * min(freq, 0.49*float64(sr)) / float64(sr)
+	cos, sin := math.Cos(w), math.Sin(w)
+	alpha := sin / (2 * q)
+	var b0, b1, b2, a0, a1, a2 float64
+	switch kind {
+	case "peak":
+		b0, b1, b2 = 1+alpha*A, -2*cos, 1-alpha*A
+		a0, a1, a2 = 1+alpha/A, -2*cos, 1-alpha/A
+	case "lowshelf":
+		s := 2 * math.Sqrt(A) * alpha
+		b0 = A * ((A + 1) - (A-1)*cos + s)
+		b1 = 2 * A * ((A - 1) - (A+1)*cos)
+		b2 = A * ((A + 1) - (A-1)*cos - s)
+		a0 = (A + 1) + (A-1)*cos + s
+		a1 = -2 * ((A - 1) + (A+1)*cos)
+		a2 = (A + 1) + (A-1)*cos - s
+	case "highshelf":
+		s := 2 * math.Sqrt(A) * alpha
+		b0 = A * ((A + 1) + (A-1)*cos + s)
+		b1 = -2 * A * ((A - 1) + (A+1)*cos)
+		b2 = A * ((A + 1) + (A-1)*cos - s)
+		a0 = (A + 1) - (A-1)*cos + s
+		a1 = 2 * ((A - 1) - (A+1)*cos)
+		a2 = (A + 1) - (A-1)*cos - s
+	default:
+		return BiquadCoeffs{}, fmt.Errorf("unknown EQ band type: %s", kind)
+	}
+	return BiquadCoeffs{b0 / a0, b1 / a0, b2 / a0, a1 / a0, a2 / a0}, nil
+}
+
+// maximum number of EQ bands
+const eqBands = 8
+
+// EQ is a parametric equalizer. Each band is given as
+// type,freq,gain[,q] where type is peak, lowshelf or highshelf and gain
+// is in dB, e.g. eq:lowshelf,100,3:peak,2500,-4,2.
+type EQ struct {
+	bands [][2]Biquad
+}
+
+func eqFactory(args string) (Processor, error) {
+	names := make([]string, eqBands)
+	for i := range names {
+		names[i] = fmt.Sprintf("band%d", i+1)
+	}
+	a := parseArgs(args, names...)
+	e := &EQ{}
+	for _, name := range names {
+		spec := a.String(name, "")
+		if spec == "" {
+			continue
+		}
+		fields := strings.Split(spec, ",")
+		if len(fields) < 3 || len(fields) > 4 {
+			return nil, fmt.Errorf("invalid EQ band: %s", spec)
+		}
+		values := make([]float64, 3)
+		values[2] = 0.707
+		for i, field := range fields[1:] {
+			value, err := parseFloat(strings.TrimSpace(field))
+			if err != nil {
+				return nil, fmt.Errorf("invalid EQ band: %s: %w", spec, err)
+			}
+			values[i] = value
+		}
+		coeffs, err := eqCoeffs(strings.TrimSpace(fields[0]), values[0], values[1], values[2])
+		if err != nil {
+			return nil, err
+		}
+		e.bands = append(e.bands, [2]Biquad{{BiquadCoeffs: coeffs}, {BiquadCoeffs: coeffs}})
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *EQ) Process(t *Track, buf SampleBuffer) {
+	for i := 0; i < len(buf); i += nchannels {
+		for b := range e.bands {
+			buf[i] = e.bands[b][0].Process(buf[i])
+			buf[i+1] = e.bands[b][1].Process(buf[i+1])
+		}
+	}
+}
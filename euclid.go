@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// matches Euclidean rhythms like E(3,8) or E(3,8,rot=1) in data lines
+var euclidPattern = regexp.MustCompile(`E\((\d+),(\d+)(?:,rot=(-?\d+))?\)`)
+
+// euclid returns k hits spread as evenly as possible over n steps,
+// rotated left by rot steps
+func euclid(k, n, rot int) string {
+	steps := make([]byte, n)
+	for i := range steps {
+		steps[i] = '.'
+		if (i*k)%n < k {
+			steps[i] = 'x'
+		}
+	}
+	rot = ((rot % n) + n) % n
+	return string(steps[rot:]) + string(steps[:rot])
+}
+
+// expandEuclid replaces the Euclidean rhythms in a data line with their
+// hits
+func expandEuclid(data string) (string, error) {
+	var err error
+	data = euclidPattern.ReplaceAllStringFunc(data, func(spec string) string {
+		m := euclidPattern.FindStringSubmatch(spec)
+		k, _ := strconv.Atoi(m[1])
+		n, _ := strconv.Atoi(m[2])
+		rot, _ := strconv.Atoi(m[3])
+		if n < 1 || k > n {
+			if err == nil {
+				err = fmt.Errorf("invalid Euclidean rhythm: %s", spec)
+			}
+			return spec
+		}
+		return euclid(k, n, rot)
+	})
+	return strings.TrimSpace(data), err
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"math"
+)
+
+// Exciter brightens a signal by adding harmonics generated by
+// saturating its content above a crossover frequency.
+type Exciter struct {
+	freq  float64 // crossover (Hz)
+	drive float64
+	even  float64 // even harmonic content (0..1)
+	mix   float64 // amount of added harmonics
+	pre   [2]SVF
+	post  [2]SVF
+}
+
+func exciterFactory(args string) (Processor, error) {
+	a := parseArgs(args, "freq", "drive", "even", "mix")
+	e := &Exciter{
+		freq:  a.Float("freq", 3000),
+		drive: a.Float("drive", 4),
+		even:  a.Float("even", 0.3),
+		mix:   a.Float("mix", 0.3),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Exciter) Process(t *Track, buf SampleBuffer) {
+	for i := 0; i < len(buf); i += nchannels {
+		for c := range e.pre {
+			x := buf[i+c]
+			_, _, high := e.pre[c].Process(x, e.freq, butterworthRes)
+			// odd harmonics from the symmetric curve, even ones from
+			// the rectified signal
+			h := math.Tanh(high*e.drive)*(1-e.even) + math.Abs(math.Tanh(high*e.drive))*e.even
+			// keep only the harmonics above the crossover
+			_, _, h = e.post[c].Process(h, e.freq, butterworthRes)
+			buf[i+c] = x + h*e.mix
+		}
+	}
+}
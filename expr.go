@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// exprParser evaluates arithmetic expressions by recursive descent
+type exprParser struct {
+	s    string
+	pos  int
+	step float64 // value of step
+}
+
+// parseFloat evaluates an arithmetic expression given where a number is
+// expected: numbers combined by + - * / and parentheses, with the names
+// bpm, step (in beats), steps and sr standing for the song settings,
+// e.g. 140*0.5 or step*3.
+func parseFloat(s string) (float64, error) {
+	return evalExpr(s, step)
+}
+
+// evalExpr evaluates expression s with step standing for stepLength;
+// the value must be finite
+func evalExpr(s string, stepLength float64) (float64, error) {
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		p := &exprParser{s: s, step: stepLength}
+		value, err = p.expr()
+		if err == nil && p.skipSpace() < len(p.s) {
+			err = fmt.Errorf("unexpected %q", p.s[p.pos:])
+		}
+		if err != nil {
+			return 0, fmt.Errorf("invalid expression: %s: %v", s, err)
+		}
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("not a finite number: %s", s)
+	}
+	return value, nil
+}
+
+// parseInt evaluates an arithmetic expression with an integer value
+func parseInt(s string) (int, error) {
+	value, err := parseFloat(s)
+	if err != nil {
+		return 0, err
+	}
+	if value != float64(int(value)) {
+		return 0, fmt.Errorf("not an integer: %s", s)
+	}
+	return int(value), nil
+}
+
+// skipSpace moves past whitespace and returns the position
+func (p *exprParser) skipSpace() int {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+	return p.pos
+}
+
+// next returns the next character without consuming it, 0 at the end
+func (p *exprParser) next() byte {
+	if p.skipSpace() < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func (p *exprParser) expr() (float64, error) {
+	value, err := p.term()
+	for err == nil {
+		op := p.next()
+		if op != '+' && op != '-' {
+			break
+		}
+		p.pos++
+		var rhs float64
+		if rhs, err = p.term(); op == '+' {
+			value += rhs
+		} else {
+			value -= rhs
+		}
+	}
+	return value, err
+}
+
+func (p *exprParser) term() (float64, error) {
+	value, err := p.unary()
+	for err == nil {
+		op := p.next()
+		if op != '*' && op != '/' {
+			break
+		}
+		p.pos++
+		var rhs float64
+		if rhs, err = p.unary(); op == '*' {
+			value *= rhs
+		} else {
+			value /= rhs
+		}
+	}
+	return value, err
+}
+
+func (p *exprParser) unary() (float64, error) {
+	switch p.next() {
+	case '-':
+		p.pos++
+		value, err := p.unary()
+		return -value, err
+	case '+':
+		p.pos++
+		return p.unary()
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (float64, error) {
+	c := p.next()
+	switch {
+	case c == '(':
+		p.pos++
+		value, err := p.expr()
+		if err != nil {
+			return 0, err
+		}
+		if p.next() != ')' {
+			return 0, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return value, nil
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.pos
+		for p.pos < len(p.s) && strings.IndexByte("0123456789.", p.s[p.pos]) != -1 {
+			p.pos++
+		}
+		if p.pos < len(p.s) && (p.s[p.pos] == 'e' || p.s[p.pos] == 'E') {
+			p.pos++
+			if p.pos < len(p.s) && (p.s[p.pos] == '+' || p.s[p.pos] == '-') {
+				p.pos++
+			}
+			for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+				p.pos++
+			}
+		}
+		return strconv.ParseFloat(p.s[start:p.pos], 64)
+	case c >= 'a' && c <= 'z':
+		start := p.pos
+		for p.pos < len(p.s) && p.s[p.pos] >= 'a' && p.s[p.pos] <= 'z' {
+			p.pos++
+		}
+		switch name := p.s[start:p.pos]; name {
+		case "bpm":
+			return bpm, nil
+		case "step":
+			return p.step, nil
+		case "steps":
+			return float64(steps), nil
+		case "sr":
+			return float64(sr), nil
+		default:
+			return 0, fmt.Errorf("unknown name: %s", name)
+		}
+	case c == 0:
+		return 0, fmt.Errorf("unexpected end")
+	}
+	return 0, fmt.Errorf("unexpected %q", p.s[p.pos:])
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseFloatExpressions(t *testing.T) {
+	defer func(b float64, s int) { bpm, steps = b, s }(bpm, steps)
+	bpm, steps = 120, 16
+	for _, test := range []struct {
+		s    string
+		want float64
+	}{
+		{"1+2*3", 7},
+		{"(1+2)*3", 9},
+		{"10/4", 2.5},
+		{"-2*3", -6},
+		{"140*0.5", 70},
+		{"bpm/2", 60},
+		{"steps*2", 32},
+	} {
+		if got, err := parseFloat(test.s); err != nil || got != test.want {
+			t.Errorf("%s: got %g, %v, want %g", test.s, got, err, test.want)
+		}
+	}
+	for _, s := range []string{"1+", "2*(3", "foo"} {
+		if _, err := parseFloat(s); err == nil {
+			t.Errorf("%s: no error", s)
+		}
+	}
+	if _, err := parseInt("7/2"); err == nil {
+		t.Error("7/2: no error for a fraction")
+	}
+}
+
+func TestDurationStepExpressions(t *testing.T) {
+	defer func(b, s float64) { bpm, step = b, s }(bpm, step)
+	bpm, step = 120, 0.25
+	track := &Track{bpm: bpm, step: step}
+	want := 4 * float64(track.SamplesPerStep())
+	for _, s := range []string{"4", "step*4", "step*4b", "step*4ms"} {
+		d, err := parseDuration(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := d.Frames(track); math.Abs(got-want) > 1e-6 {
+			t.Errorf("%s: got %g frames, want %g", s, got, want)
+		}
+	}
+}
+
+func TestParseKeyExpressions(t *testing.T) {
+	for _, test := range []struct {
+		s    string
+		want float64
+	}{
+		{"60", 60},
+		{"60+7", 67},
+		{"12*5", 60},
+		{"C4", 60},
+		{"A#3", 58},
+	} {
+		if got, err := parseKey(test.s); err != nil || got != test.want {
+			t.Errorf("%s: got %g, %v, want %g", test.s, got, err, test.want)
+		}
+	}
+}
+
+func TestParseFloatRejectsNonFinite(t *testing.T) {
+	for _, s := range []string{"nan", "NaN", "inf", "-Inf", "1e999", "1/0", "0/0"} {
+		if value, err := parseFloat(s); err == nil {
+			t.Errorf("%s: got %g, want an error", s, value)
+		}
+	}
+}
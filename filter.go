@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// SVF is a state-variable filter (trapezoidal integration) producing
+// low-pass, band-pass and high-pass outputs at once.
+type SVF struct {
+	ic1eq float64
+	ic2eq float64
+}
+
+// Process filters x with the given cutoff (Hz) and resonance (0..1).
+func (f *SVF) Process(x, cutoff, res float64) (lp, bp, hp float64) {
+	cutoff = min(max(cutoff, 10), 0.49*float64(sr))
+	g := math.Tan(math.Pi * cutoff / float64(sr))
+	k := 2 - 2*min(max(res, 0), 0.995)
+	a1 := 1 / (1 + g*(g+k))
+	a2 := g * a1
+	a3 := g * a2
+	v3 := x - f.ic2eq
+	v1 := a1*f.ic1eq + a2*v3
+	v2 := f.ic2eq + a2*f.ic1eq + a3*v3
+	f.ic1eq = 2*v1 - f.ic1eq
+	f.ic2eq = 2*v2 - f.ic2eq
+	return v2, v1, x - k*v1 - v2
+}
+
+type FilterMode int
+
+const (
+	LowPass FilterMode = iota
+	HighPass
+	BandPass
+	Notch
+)
+
+var filterModes = map[string]FilterMode{
+	"lp":    LowPass,
+	"hp":    HighPass,
+	"bp":    BandPass,
+	"notch": Notch,
+}
+
+func parseFilterMode(name string) (FilterMode, error) {
+	if mode, ok := filterModes[name]; ok {
+		return mode, nil
+	}
+	return LowPass, fmt.Errorf("unknown filter mode: %s", name)
+}
+
+// Filter returns the output of the filter for the given mode
+func (f *SVF) Filter(x, cutoff, res float64, mode FilterMode) float64 {
+	lp, bp, hp := f.Process(x, cutoff, res)
+	switch mode {
+	case HighPass:
+		return hp
+	case BandPass:
+		return bp
+	case Notch:
+		return lp + hp
+	}
+	return lp
+}
+
+// qToRes converts a filter quality factor to the resonance taken by SVF
+func qToRes(q float64) float64 {
+	return 1 - 1/(2*q)
+}
+
+// DCBlocker removes the DC offset of a signal.
+type DCBlocker struct {
+	x1, y1 float64
+}
+
+func (d *DCBlocker) Process(x float64) float64 {
+	y := x - d.x1 + 0.995*d.y1
+	d.x1, d.y1 = x, y
+	return y
+}
+
+// FilterEffect is a state-variable filter with input saturation applied
+// to the pattern buffer.
+type FilterEffect struct {
+	mode    FilterMode
+	cutoff  float64 // Hz
+	res     float64 // 0..1
+	drive   float64 // saturation gain, 0 = clean
+	filters [2]SVF
+}
+
+func filterFactory(args string) (Processor, error) {
+	a := parseArgs(args, "mode", "cutoff", "res", "drive")
+	mode, err := parseFilterMode(a.String("mode", "lp"))
+	if err != nil {
+		return nil, err
+	}
+	f := &FilterEffect{
+		mode:   mode,
+		cutoff: a.Float("cutoff", 1000),
+		res:    a.Float("res", 0.2),
+		drive:  a.Float("drive", 0),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *FilterEffect) Process(t *Track, buf SampleBuffer) {
+	cutoffParam := t.Param("cutoff", f.cutoff, 20, 20000)
+	resParam := t.Param("res", f.res, 0, 1)
+	driveParam := t.Param("drive", f.drive, 0, 10)
+	for i := 0; i < len(buf); i += nchannels {
+		frame := i / nchannels
+		cutoff, res, drive := cutoffParam.At(frame), resParam.At(frame), driveParam.At(frame)
+		for c := 0; c < 2; c++ {
+			x := buf[i+c]
+			if drive > 0 {
+				x = math.Tanh(x*drive) / math.Tanh(drive)
+			}
+			buf[i+c] = f.filters[c].Filter(x, cutoff, res, f.mode)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Flanger mixes the signal with a copy read from a short delay line
+// swept by an LFO, feeding part of the output back into the line.
+type Flanger struct {
+	period   Duration // LFO period
+	manual   float64  // minimum delay (seconds)
+	depth    float64  // delay sweep (seconds)
+	feedback float64
+	mix      float64 // dry/wet (0..1)
+	lfo      *LFO
+	lines    [2]*DelayLine
+	last     [2]float64
+}
+
+func flangerFactory(args string) (Processor, error) {
+	a := parseArgs(args, "period", "depth", "feedback", "manual", "mix")
+	f := &Flanger{
+		period:   a.Duration("period", "32"),
+		depth:    a.Float("depth", 0.004),
+		feedback: a.Float("feedback", 0.6),
+		manual:   a.Float("manual", 0.001),
+		mix:      a.Float("mix", 0.5),
+		lfo:      NewLFO(Triangle, 0),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	if math.Abs(f.feedback) >= 1 {
+		return nil, fmt.Errorf("invalid feedback value: %g", f.feedback)
+	}
+	frames := int((f.manual + f.depth) * float64(sr))
+	f.lines = [2]*DelayLine{NewDelayLine(frames + 1), NewDelayLine(frames + 1)}
+	return f, nil
+}
+
+func (f *Flanger) Process(t *Track, buf SampleBuffer) {
+	f.lfo.Sync(t, f.period)
+	for i := 0; i < len(buf); i += nchannels {
+		delay := (f.manual + f.depth*(f.lfo.Next()+1)/2) * float64(sr)
+		for c := range f.lines {
+			x := buf[i+c]
+			f.lines[c].Write(x + f.last[c]*f.feedback)
+			f.last[c] = f.lines[c].Read(delay)
+			buf[i+c] = x*(1-f.mix) + f.last[c]*f.mix
+		}
+	}
+}
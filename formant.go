@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+)
+
+type formant struct {
+	freq float64 // Hz
+	gain float64
+	bw   float64 // bandwidth (Hz)
+}
+
+var vowelFormants = map[byte][3]formant{
+	'a': {{800, 1, 80}, {1150, 0.5, 90}, {2900, 0.025, 120}},
+	'e': {{350, 1, 60}, {2000, 0.1, 100}, {2800, 0.18, 120}},
+	'i': {{270, 1, 60}, {2140, 0.25, 90}, {2950, 0.05, 100}},
+	'o': {{450, 1, 70}, {800, 0.28, 80}, {2830, 0.08, 100}},
+	'u': {{325, 1, 50}, {700, 0.16, 60}, {2700, 0.002, 170}},
+}
+
+// FormantSynth filters a pulse wave through three parallel band-pass
+// filters tuned to vowel formants, morphing through a vowel sequence.
+type FormantSynth struct {
+	vowels []byte
+	time   float64 // seconds to morph through the whole sequence
+	note   float64 // key of the first note character
+	adsr   ADSR
+	gain   float64
+}
+
+func formantSynthFactory(args string) (Processor, error) {
+	a := parseArgs(args, "vowels", "time", "note", "attack", "decay", "sustain", "release", "gain")
+	s := &FormantSynth{
+		vowels: []byte(a.String("vowels", "a")),
+		time:   a.Float("time", 0.5),
+		note:   a.Key("note", 48),
+		adsr: ADSR{
+			Attack:  a.Float("attack", 0.02),
+			Decay:   a.Float("decay", 0.1),
+			Sustain: a.Float("sustain", 0.8),
+			Release: a.Float("release", 0.1),
+		},
+		gain: a.Float("gain", 2),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	for _, v := range s.vowels {
+		if _, ok := vowelFormants[v]; !ok {
+			return nil, fmt.Errorf("unknown vowel: %c", v)
+		}
+	}
+	if len(s.vowels) == 0 {
+		return nil, fmt.Errorf("missing vowels")
+	}
+	return s, nil
+}
+
+// formants returns the formants at position pos (0..1) of the sequence
+func (s *FormantSynth) formants(pos float64) [3]formant {
+	if len(s.vowels) == 1 {
+		return vowelFormants[s.vowels[0]]
+	}
+	x := pos * float64(len(s.vowels)-1)
+	i := min(int(x), len(s.vowels)-2)
+	frac := x - float64(i)
+	from, to := vowelFormants[s.vowels[i]], vowelFormants[s.vowels[i+1]]
+	var out [3]formant
+	for k := range out {
+		out[k] = formant{
+			freq: from[k].freq + (to[k].freq-from[k].freq)*frac,
+			gain: from[k].gain + (to[k].gain-from[k].gain)*frac,
+			bw:   from[k].bw + (to[k].bw-from[k].bw)*frac,
+		}
+	}
+	return out
+}
+
+func (s *FormantSynth) Process(t *Track, buf SampleBuffer) {
+	renderNotes(buf, t.Notes(s.note), func(n Note) Voice {
+		return &formantVoice{
+			synth: s,
+			osc:   Oscillator{wave: Pulse, width: 0.2},
+			freq:  noteFreq(n.Key),
+			env:   NewEnvelope(s.adsr),
+			gain:  s.gain * n.Velocity,
+		}
+	})
+}
+
+type formantVoice struct {
+	synth   *FormantSynth
+	osc     Oscillator
+	filters [3]SVF
+	freq    float64
+	age     int
+	env     *Envelope
+	gain    float64
+}
+
+func (v *formantVoice) Next(gate bool) (l, r float64) {
+	pos := 1.0
+	if v.synth.time > 0 {
+		pos = min(float64(v.age)/(v.synth.time*float64(sr)), 1)
+	}
+	v.age++
+	in := v.osc.Next(v.freq)
+	out := 0.0
+	for k, f := range v.synth.formants(pos) {
+		_, bp, _ := v.filters[k].Process(in, f.freq, qToRes(f.freq/f.bw))
+		out += bp * f.gain * f.bw / f.freq
+	}
+	out *= v.env.Next(gate) * v.gain
+	return out, out
+}
+
+func (v *formantVoice) Done() bool {
+	return v.env.Done()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"math"
+)
+
+// Gate attenuates the signal while its level stays below threshold.
+// When the track has a trigger data line the gate opens on the hits
+// instead, at the level of their velocity, chopping the signal
+// rhythmically.
+type Gate struct {
+	threshold float64 // dB
+	attack    float64 // seconds
+	hold      float64 // seconds
+	release   float64 // seconds
+	floor     float64 // gain while closed
+	env       float64
+	held      int // frames left to hold the gate open
+}
+
+func gateFactory(args string) (Processor, error) {
+	a := parseArgs(args, "threshold", "attack", "hold", "release", "range")
+	g := &Gate{
+		threshold: a.Float("threshold", -40),
+		attack:    a.Float("attack", 0.001),
+		hold:      a.Float("hold", 0.01),
+		release:   a.Float("release", 0.05),
+		floor:     math.Pow(10, a.Float("range", -80)/20),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *Gate) Process(t *Track, buf SampleBuffer) {
+	frames := len(buf) / nchannels
+	var keys []float64
+	if _, ok := t.data[triggerCode]; ok {
+		keys = make([]float64, frames)
+		for _, n := range t.Triggers(triggerCode) {
+			for i := n.Start; i < n.Start+n.Length && i < frames; i++ {
+				keys[i] = n.Velocity
+			}
+		}
+	}
+	threshold := math.Pow(10, g.threshold/20)
+	attack, release := coeff(g.attack), coeff(g.release)
+	for i := 0; i < frames; i++ {
+		l, r := buf[i*nchannels], buf[i*nchannels+1]
+		target := 0.0
+		if keys != nil {
+			target = keys[i]
+		} else if max(math.Abs(l), math.Abs(r)) >= threshold {
+			target = 1
+		}
+		if target > 0 {
+			g.held = int(g.hold * float64(sr))
+		}
+		switch {
+		case target > g.env:
+			g.env = target + attack*(g.env-target)
+		case g.held > 0 && target == 0:
+			g.held--
+		default:
+			g.env = target + release*(g.env-target)
+		}
+		gain := g.floor + (1-g.floor)*g.env
+		buf[i*nchannels] = l * gain
+		buf[i*nchannels+1] = r * gain
+	}
+}
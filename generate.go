@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// matches L-systems like lsys(x,x=x.;.=x,3) in data lines: an axiom,
+// rewriting rules of a step each separated by ; and the number of
+// rewrites
+var lsysPattern = regexp.MustCompile(`lsys\(([^,()]+),([^,()]*),(\d+)\)`)
+
+// matches Markov chains like markov(1,2,x..xx.x.) or
+// markov(1,2,/bass,32) in data lines: a seed, the order of the chain,
+// the steps it learns from or /name for the same line of track name in
+// the pattern, and the number of steps to generate, by default as many
+var markovPattern = regexp.MustCompile(`markov\((-?\d+),(\d+),([^,()]+)(?:,(\d+))?\)`)
+
+// longest data generated by an L-system
+const maxGenerated = 4096
+
+// lsys rewrites the steps of axiom depth times by rules; steps without
+// a rule stay
+func lsys(axiom string, rules map[string]string, depth int) (string, error) {
+	data := axiom
+	for range depth {
+		var sb strings.Builder
+		for _, token := range stepTokens(data) {
+			if r, ok := rules[token]; ok {
+				sb.WriteString(r)
+			} else {
+				sb.WriteString(token)
+			}
+		}
+		data = sb.String()
+		if len(data) > maxGenerated {
+			return "", fmt.Errorf("L-system grows longer than %d steps", maxGenerated)
+		}
+	}
+	return data, nil
+}
+
+// markov generates n steps by a Markov chain of the given order which
+// follows the transitions between the steps of source, taken as a loop
+func markov(seed int64, order int, source string, n int) string {
+	tokens := stepTokens(source)
+	order = min(order, len(tokens))
+	next := make(map[string][]string)
+	for i := range tokens {
+		state := strings.Join(cyclic(tokens, i, order), "")
+		next[state] = append(next[state], tokens[(i+order)%len(tokens)])
+	}
+	rng := rand.New(rand.NewSource(seed))
+	out := cyclic(tokens, 0, order)
+	for len(out) < n {
+		state := strings.Join(out[len(out)-order:], "")
+		choices := next[state]
+		out = append(out, choices[rng.Intn(len(choices))])
+	}
+	return strings.Join(out[:n], "")
+}
+
+// cyclic returns n tokens starting at i, wrapping around
+func cyclic(tokens []string, i, n int) []string {
+	out := make([]string, n)
+	for j := range out {
+		out[j] = tokens[(i+j)%len(tokens)]
+	}
+	return out
+}
+
+// trackData returns data line code of the track called name in p
+func trackData(p Pattern, code rune, name string) (string, error) {
+	for _, t := range p {
+		if t.name != name {
+			continue
+		}
+		if data, ok := t.data[code]; ok {
+			return data, nil
+		}
+		return "", fmt.Errorf("no %c line in track: %s", code, name)
+	}
+	return "", fmt.Errorf("unknown track: %s", name)
+}
+
+// expandGenerators replaces the L-systems and Markov chains in data line
+// code with the steps they generate; Markov chains can learn from the
+// tracks of pattern p
+func expandGenerators(data string, code rune, p Pattern) (string, error) {
+	var err error
+	fail := func(e error) {
+		if err == nil {
+			err = e
+		}
+	}
+	data = lsysPattern.ReplaceAllStringFunc(data, func(spec string) string {
+		m := lsysPattern.FindStringSubmatch(spec)
+		rules := make(map[string]string)
+		for _, rule := range strings.Split(m[2], ";") {
+			from, to, ok := strings.Cut(rule, "=")
+			if !ok || len(stepTokens(from)) != 1 {
+				fail(fmt.Errorf("invalid L-system rule: %s", rule))
+				return spec
+			}
+			rules[from] = to
+		}
+		depth, _ := strconv.Atoi(m[3])
+		value, e := lsys(m[1], rules, depth)
+		if e != nil {
+			fail(e)
+			return spec
+		}
+		return value
+	})
+	data = markovPattern.ReplaceAllStringFunc(data, func(spec string) string {
+		m := markovPattern.FindStringSubmatch(spec)
+		seed, _ := strconv.ParseInt(m[1], 10, 64)
+		order, _ := strconv.Atoi(m[2])
+		source := m[3]
+		if name, ok := strings.CutPrefix(source, "/"); ok {
+			var e error
+			if source, e = trackData(p, code, name); e != nil {
+				fail(e)
+				return spec
+			}
+		}
+		length := len(stepTokens(source))
+		n := length
+		if m[4] != "" {
+			n, _ = strconv.Atoi(m[4])
+		}
+		if order < 1 || length == 0 || n > maxGenerated {
+			fail(fmt.Errorf("invalid Markov chain: %s", spec))
+			return spec
+		}
+		return markov(seed, order, source, n)
+	})
+	return data, err
+}
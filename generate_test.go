@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestLsys(t *testing.T) {
+	// x -> x. -> x.xx
+	got, err := expandGenerators("lsys(x,x=x.;.=xx,2)", 'x', nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "x.xx" {
+		t.Errorf("got %s, want x.xx", got)
+	}
+	if _, err := expandGenerators("lsys(x,x=xx,20)", 'x', nil); err == nil {
+		t.Error("no error for an overlong L-system")
+	}
+}
+
+func TestMarkovFollowsTransitions(t *testing.T) {
+	// every x is followed by a rest and every rest by x
+	got, err := expandGenerators("markov(5,1,x.x.,8)", 'x', nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "x.x.x.x." {
+		t.Errorf("got %s, want x.x.x.x.", got)
+	}
+}
+
+func TestMarkovTrackSource(t *testing.T) {
+	p := Pattern{{name: "bass", data: DataLines{'x': "x..xx.x."}}}
+	got, err := expandGenerators("markov(3,1,/bass)", 'x', p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := markov(3, 1, "x..xx.x.", 8); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	for _, data := range []string{"markov(3,1,/lead)", "markov(3,1,/bass)"} {
+		if _, err := expandGenerators(data, 'n', p); err == nil {
+			t.Errorf("%s: no error for a missing line", data)
+		}
+	}
+}
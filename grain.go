@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+type GrainSynth struct {
+	sample  *Sample
+	root    float64 // key at which the sample plays at original pitch
+	size    float64 // grain length in seconds
+	density float64 // grains per second
+	pos     float64 // grain start position in the sample (0..1)
+	jitter  float64 // random deviation of the start position (0..1)
+	pitch   float64 // semitones
+	adsr    ADSR
+	gain    float64
+	rng     *rand.Rand
+}
+
+func grainSynthFactory(args string) (Processor, error) {
+	a := parseArgs(args, "path", "size", "density", "pos", "jitter", "pitch",
+		"attack", "decay", "sustain", "release", "gain", "root")
+	path := a.String("path", "")
+	if path == "" {
+		return nil, fmt.Errorf("missing sample path")
+	}
+	s := &GrainSynth{
+		root:    a.Key("root", 60),
+		size:    a.Float("size", 0.08),
+		density: a.Float("density", 20),
+		pos:     a.Float("pos", 0),
+		jitter:  a.Float("jitter", 0.05),
+		pitch:   a.Float("pitch", 0),
+		adsr: ADSR{
+			Attack:  a.Float("attack", 0.05),
+			Decay:   a.Float("decay", 0),
+			Sustain: a.Float("sustain", 1),
+			Release: a.Float("release", 0.2),
+		},
+		gain: a.Float("gain", 0.5),
+		rng:  rand.New(rand.NewSource(1)),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	if s.size <= 0 || s.density <= 0 {
+		return nil, fmt.Errorf("grain size and density must be positive")
+	}
+	sample, err := loadSample(path)
+	if err != nil {
+		return nil, err
+	}
+	s.sample = sample
+	return s, nil
+}
+
+func (s *GrainSynth) Process(t *Track, buf SampleBuffer) {
+	renderNotes(buf, t.Notes(s.root), func(n Note) Voice {
+		return &grainVoice{
+			synth: s,
+			rate:  keyRatio(n.Key+s.pitch, s.root) * float64(s.sample.rate) / float64(sr),
+			env:   NewEnvelope(s.adsr),
+			gain:  s.gain * n.Velocity,
+		}
+	})
+}
+
+type grain struct {
+	pos    float64 // read position in the sample (frames)
+	age    int     // frames since grain start
+	length int     // grain length in frames
+}
+
+type grainVoice struct {
+	synth  *GrainSynth
+	grains []grain
+	rate   float64 // sample frames per output frame
+	next   float64 // frames until the next grain starts
+	env    *Envelope
+	gain   float64
+}
+
+func (v *grainVoice) spawn() {
+	s := v.synth
+	start := s.pos + s.jitter*(2*s.rng.Float64()-1)
+	start = min(max(start, 0), 1)
+	v.grains = append(v.grains, grain{
+		pos:    start * float64(s.sample.Frames()),
+		length: max(int(s.size*float64(sr)), 1),
+	})
+}
+
+func (v *grainVoice) Next(gate bool) (l, r float64) {
+	v.next--
+	if v.next <= 0 {
+		v.spawn()
+		v.next += float64(sr) / v.synth.density
+	}
+	// overlapping grains are scaled so the sum stays around unity
+	norm := 1 / math.Max(1, v.synth.size*v.synth.density/2)
+	alive := v.grains[:0]
+	for _, g := range v.grains {
+		w := 0.5 - 0.5*math.Cos(2*math.Pi*float64(g.age)/float64(g.length))
+		gl, gr := v.synth.sample.At(g.pos)
+		l += gl * w * norm
+		r += gr * w * norm
+		g.pos += v.rate
+		g.age++
+		if g.age < g.length {
+			alive = append(alive, g)
+		}
+	}
+	v.grains = alive
+	amp := v.env.Next(gate) * v.gain
+	return l * amp, r * amp
+}
+
+func (v *grainVoice) Done() bool {
+	return v.env.Done()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+)
+
+// GrainDelay plays grains taken from a delay line: each grain starts at
+// the delay time plus a random scatter, is pitched, may play reversed,
+// and its output is fed back into the line.
+type GrainDelay struct {
+	time     Duration
+	size     float64 // grain length (seconds)
+	density  float64 // grains per second
+	pitch    float64 // semitones
+	reverse  float64 // probability of reversed grains (0..1)
+	scatter  float64 // random extra delay (seconds)
+	feedback float64
+	mix      float64 // dry/wet (0..1)
+	lines    [2]*DelayLine
+	grains   []*delayGrain
+	wait     float64 // frames until the next grain
+	rng      *rand.Rand
+}
+
+// longest grains and delays (seconds), which bound the delay lines
+const (
+	maxGrainSize  = 1
+	maxGrainDelay = 10
+)
+
+type delayGrain struct {
+	delay  float64 // read position (frames behind the write position)
+	drift  float64 // change of delay per frame
+	age    int
+	length int
+	pan    float64 // -1..1
+}
+
+func grainDelayFactory(args string) (Processor, error) {
+	a := parseArgs(args, "time", "size", "density", "pitch", "reverse", "scatter", "feedback", "mix")
+	d := &GrainDelay{
+		time:     a.Duration("time", "4"),
+		size:     min(a.Float("size", 0.08), maxGrainSize),
+		density:  a.Float("density", 20),
+		pitch:    clampShift(a.Float("pitch", 0)),
+		reverse:  a.Float("reverse", 0.3),
+		scatter:  min(max(a.Float("scatter", 0.1), 0), maxGrainDelay),
+		feedback: a.Float("feedback", 0.3),
+		mix:      a.Float("mix", 0.4),
+		rng:      rand.New(rand.NewSource(1)),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *GrainDelay) Process(t *Track, buf SampleBuffer) {
+	ratio := math.Pow(2, d.pitch/12)
+	length := max(int(d.size*float64(sr)), 1)
+	base := min(d.time.Frames(t), maxGrainDelay*float64(sr))
+	scatter := d.scatter * float64(sr)
+	size := int(base+scatter+(1+ratio)*float64(length)) + 2
+	for c := range d.lines {
+		if d.lines[c] == nil || len(d.lines[c].buf) < size+2 {
+			d.lines[c] = NewDelayLine(size)
+		}
+	}
+	// grains overlap density*size times on average
+	norm := 1 / math.Sqrt(max(d.density*d.size, 1))
+	for i := 0; i < len(buf); i += nchannels {
+		if d.wait -= 1; d.wait <= 0 && d.density > 0 {
+			d.wait += float64(sr) / d.density
+			g := &delayGrain{
+				delay:  base + scatter*d.rng.Float64(),
+				drift:  1 - ratio,
+				length: length,
+				pan:    2*d.rng.Float64() - 1,
+			}
+			if d.rng.Float64() < d.reverse {
+				g.drift = 1 + ratio
+			}
+			// grains read ahead of the write position when pitched up
+			g.delay = max(g.delay, 1-g.drift*float64(length))
+			d.grains = append(d.grains, g)
+		}
+		var l, r float64
+		live := d.grains[:0]
+		for _, g := range d.grains {
+			w := math.Sin(math.Pi * float64(g.age) / float64(g.length))
+			w *= w
+			l += d.lines[0].Read(g.delay) * w * (1 - g.pan) / 2
+			r += d.lines[1].Read(g.delay) * w * (1 + g.pan) / 2
+			g.delay += g.drift
+			if g.age++; g.age < g.length {
+				live = append(live, g)
+			}
+		}
+		d.grains = live
+		l, r = l*norm*2, r*norm*2
+		inL, inR := buf[i], buf[i+1]
+		d.lines[0].Write(inL + l*d.feedback)
+		d.lines[1].Write(inR + r*d.feedback)
+		buf[i] = inL*(1-d.mix) + l*d.mix
+		buf[i+1] = inR*(1-d.mix) + r*d.mix
+	}
+}
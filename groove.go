@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// Groove is a template of timing and velocity offsets for the 16ths of
+// a bar, repeating over the steps of a track.
+type Groove struct {
+	timing   []float64 // offset of each 16th, in 16ths
+	velocity []float64 // velocity gain of each 16th
+}
+
+// groove applied to the tracks, nil for none
+var groove *Groove
+
+// loadGroove reads a groove template: a line for each 16th with its
+// timing offset in percent of a 16th (negative is early) and optionally
+// its velocity in percent. Lines starting with # are comments.
+func loadGroove(filename string) (*Groove, error) {
+	f, err := os.Open(songPath(filename))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	g := &Groove{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("%s: invalid groove line: %s", filename, scanner.Text())
+		}
+		timing, err := parseFloat(strings.TrimPrefix(fields[0], "+"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid timing offset: %s", filename, fields[0])
+		}
+		velocity := 100.0
+		if len(fields) == 2 {
+			if velocity, err = parseFloat(fields[1]); err != nil || velocity < 0 {
+				return nil, fmt.Errorf("%s: invalid velocity: %s", filename, fields[1])
+			}
+		}
+		g.timing = append(g.timing, timing/100)
+		g.velocity = append(g.velocity, velocity/100)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(g.timing) == 0 {
+		return nil, fmt.Errorf("%s: empty groove", filename)
+	}
+	return g, nil
+}
+
+// sixteenth returns the index in the groove of the 16th on which step i
+// of t starts, or -1 if the step is off the 16th grid
+func (g *Groove) sixteenth(t *Track, i int) int {
+	pos := float64(i) * t.step * 4
+	if pos != math.Trunc(pos) {
+		return -1
+	}
+	return int(pos) % len(g.timing)
+}
+
+// Offset returns the shift of step i of t in frames
+func (g *Groove) Offset(t *Track, i int) int {
+	j := g.sixteenth(t, i)
+	if j == -1 {
+		return 0
+	}
+	return int(g.timing[j] * float64(t.StepFrames(i)) / (t.step * 4))
+}
+
+// Velocity returns the velocity gain of step i of t
+func (g *Groove) Velocity(t *Track, i int) float64 {
+	j := g.sixteenth(t, i)
+	if j == -1 {
+		return 1
+	}
+	return g.velocity[j]
+}
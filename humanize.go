@@ -0,0 +1,82 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// delay between the notes of strummed chords (seconds), negative to strum
+// from the top
+var strum float64
+
+// Humanize is the range of the random offsets applied to notes.
+type Humanize struct {
+	timing   float64 // seconds
+	velocity float64 // fraction of the velocity
+}
+
+var humanize Humanize
+
+// parseHumanize parses the timing range in ms and the velocity range in
+// percent, like 10,5
+func parseHumanize(s string) (Humanize, error) {
+	var h Humanize
+	timing, velocity, _ := strings.Cut(s, ",")
+	var err error
+	if h.timing, err = parseFloat(strings.TrimSpace(timing)); err != nil || h.timing < 0 {
+		return h, fmt.Errorf("invalid humanize timing: %s", timing)
+	}
+	if velocity != "" {
+		if h.velocity, err = parseFloat(strings.TrimSpace(velocity)); err != nil || h.velocity < 0 {
+			return h, fmt.Errorf("invalid humanize velocity: %s", velocity)
+		}
+	}
+	h.timing /= 1000
+	h.velocity /= 100
+	return h, nil
+}
+
+// strumNotes delays each note of a chord by the strum delay after the one
+// below it, keeping the ends of the notes in place
+func (t *Track) strumNotes(notes []Note) []Note {
+	if t.strum == 0 {
+		return notes
+	}
+	delay := int(t.strum * float64(sr))
+	for i := 0; i < len(notes); {
+		j := i + 1
+		for j < len(notes) && notes[j].Start == notes[i].Start {
+			j++
+		}
+		chord := notes[i:j]
+		slices.SortFunc(chord, func(a, b Note) int { return cmp.Compare(a.Key, b.Key) })
+		for k := range chord {
+			d := k * delay
+			if delay < 0 {
+				d = (k - len(chord) + 1) * delay
+			}
+			d = min(d, chord[k].Length-1)
+			chord[k].Start += d
+			chord[k].Length -= d
+		}
+		i = j
+	}
+	return notes
+}
+
+// humanizeNotes moves notes and changes their velocities by random amounts
+// within the humanize ranges of the track
+func (t *Track) humanizeNotes(notes []Note) []Note {
+	h := t.humanize
+	if h.timing == 0 && h.velocity == 0 {
+		return notes
+	}
+	for i := range notes {
+		n := &notes[i]
+		n.Start = max(n.Start+int(h.timing*float64(sr)*(2*t.rng.Float64()-1)), 0)
+		n.Velocity *= max(1+h.velocity*(2*t.rng.Float64()-1), 0)
+	}
+	return notes
+}
@@ -0,0 +1,22 @@
+package main
+
+// LFO is a low frequency oscillator producing values in -1..1.
+type LFO struct {
+	osc  Oscillator
+	rate float64 // Hz
+}
+
+func NewLFO(wave Waveform, rate float64) *LFO {
+	return &LFO{osc: Oscillator{wave: wave}, rate: rate}
+}
+
+func (l *LFO) Next() float64 {
+	return l.osc.Next(l.rate)
+}
+
+// Sync sets the rate so that one cycle lasts period on track t
+func (l *LFO) Sync(t *Track, period Duration) {
+	if frames := period.Frames(t); frames > 0 {
+		l.rate = float64(sr) / frames
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"math"
+)
+
+// Limiter is a lookahead brickwall limiter applied to the whole song.
+// Peaks are measured between samples too, so the output stays below the
+// ceiling after reconstruction.
+type Limiter struct {
+	ceiling   float64 // dBFS
+	lookahead float64 // seconds
+	release   float64 // seconds
+}
+
+func parseLimiter(args string) (*Limiter, error) {
+	a := parseArgs(args, "ceiling", "lookahead", "release")
+	l := &Limiter{
+		ceiling:   a.Float("ceiling", -0.3),
+		lookahead: a.Float("lookahead", 0.005),
+		release:   a.Float("release", 0.1),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// truePeak returns the peak of the stereo signal around frame i,
+// estimating the reconstructed waveform with cubic interpolation at 4x
+// oversampling
+func truePeak(buf SampleBuffer, i int) float64 {
+	frames := len(buf) / nchannels
+	at := func(j, c int) float64 {
+		j = min(max(j, 0), frames-1)
+		return buf[j*nchannels+c]
+	}
+	peak := 0.0
+	for c := 0; c < 2; c++ {
+		y0, y1, y2, y3 := at(i-1, c), at(i, c), at(i+1, c), at(i+2, c)
+		peak = max(peak, math.Abs(y1))
+		for k := 1; k < 4; k++ {
+			x := float64(k) / 4
+			// Catmull-Rom spline between y1 and y2
+			y := y1 + 0.5*x*(y2-y0+x*(2*y0-5*y1+4*y2-y3+x*(3*(y1-y2)+y3-y0)))
+			peak = max(peak, math.Abs(y))
+		}
+	}
+	return peak
+}
+
+func (l *Limiter) Process(buf SampleBuffer) {
+	frames := len(buf) / nchannels
+	if frames == 0 {
+		return
+	}
+	ceiling := math.Pow(10, l.ceiling/20)
+	window := max(int(l.lookahead*float64(sr)), 1)
+	gains := make([]float64, frames)
+	for i := range gains {
+		gains[i] = min(1, ceiling/max(truePeak(buf, i), 1e-9))
+	}
+	// minimum gain over the lookahead window (monotonic deque)
+	target := make([]float64, frames)
+	var deque []int
+	for i := frames - 1; i >= 0; i-- {
+		for len(deque) > 0 && gains[deque[len(deque)-1]] >= gains[i] {
+			deque = deque[:len(deque)-1]
+		}
+		deque = append(deque, i)
+		if deque[0] > i+window {
+			deque = deque[1:]
+		}
+		target[i] = gains[deque[0]]
+	}
+	// release towards unity, then smooth the attack over the window
+	release := coeff(l.release)
+	g := 1.0
+	for i := range target {
+		if target[i] < g {
+			g = target[i]
+		} else {
+			g = target[i] + release*(g-target[i])
+		}
+		target[i] = g
+	}
+	sum := 0.0
+	for i := 0; i < frames; i++ {
+		sum += target[i]
+		if i >= window {
+			sum -= target[i-window]
+		}
+		g := sum / float64(min(i+1, window))
+		for c := 0; c < 2; c++ {
+			buf[i*nchannels+c] = min(max(buf[i*nchannels+c]*g, -ceiling), ceiling)
+		}
+	}
+}
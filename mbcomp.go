@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// maximum number of multiband compressor crossovers
+const mbCrossovers = 3
+
+// resonance giving a Butterworth response (Q = 1/sqrt 2)
+var butterworthRes = qToRes(math.Sqrt2 / 2)
+
+// Crossover splits a signal into low and high bands with 4th order
+// Linkwitz-Riley filters, which sum back to a flat response.
+type Crossover struct {
+	freq float64
+	lp   [2]SVF
+	hp   [2]SVF
+}
+
+func (x *Crossover) Split(in float64) (low, high float64) {
+	low, high = in, in
+	for i := range x.lp {
+		low, _, _ = x.lp[i].Process(low, x.freq, butterworthRes)
+		_, _, high = x.hp[i].Process(high, x.freq, butterworthRes)
+	}
+	return low, high
+}
+
+// MultibandCompressor compresses the bands between crossover
+// frequencies separately. Settings given as lists apply to the bands
+// from low to high, the last value repeating for the remaining bands.
+type MultibandCompressor struct {
+	xovers [][2]Crossover
+	comps  []Compressor
+}
+
+func mbcompFactory(args string) (Processor, error) {
+	a := parseArgs(args, "xover", "threshold", "ratio", "attack", "release", "makeup", "knee")
+	freqs := a.Floats("xover", []float64{200, 2000})
+	thresholds := a.Floats("threshold", []float64{-18})
+	ratios := a.Floats("ratio", []float64{3})
+	attacks := a.Floats("attack", []float64{0.02, 0.01, 0.005})
+	releases := a.Floats("release", []float64{0.2, 0.1, 0.05})
+	makeups := a.Floats("makeup", []float64{0})
+	knees := a.Floats("knee", []float64{6})
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	if len(freqs) == 0 || len(freqs) > mbCrossovers {
+		return nil, fmt.Errorf("multiband compressor needs 1 to %d crossovers", mbCrossovers)
+	}
+	for _, ratio := range ratios {
+		if ratio < 1 {
+			return nil, fmt.Errorf("invalid ratio value: %g", ratio)
+		}
+	}
+	bands := len(freqs) + 1
+	m := &MultibandCompressor{}
+	for _, freq := range freqs {
+		m.xovers = append(m.xovers, [2]Crossover{{freq: freq}, {freq: freq}})
+	}
+	thresholds = extend(thresholds, bands)
+	ratios = extend(ratios, bands)
+	attacks = extend(attacks, bands)
+	releases = extend(releases, bands)
+	makeups = extend(makeups, bands)
+	knees = extend(knees, bands)
+	for b := 0; b < bands; b++ {
+		m.comps = append(m.comps, Compressor{
+			threshold: thresholds[b],
+			ratio:     ratios[b],
+			knee:      knees[b],
+			attack:    attacks[b],
+			release:   releases[b],
+			makeup:    makeups[b],
+		})
+	}
+	return m, nil
+}
+
+func (m *MultibandCompressor) Process(t *Track, buf SampleBuffer) {
+	for i := 0; i < len(buf); i += nchannels {
+		rest := [2]float64{buf[i], buf[i+1]}
+		var out [2]float64
+		for b := range m.comps {
+			band := rest
+			if b < len(m.xovers) {
+				for c := range rest {
+					band[c], rest[c] = m.xovers[b][c].Split(rest[c])
+				}
+			}
+			g := m.comps[b].Gain(max(math.Abs(band[0]), math.Abs(band[1])))
+			out[0] += band[0] * g
+			out[1] += band[1] * g
+		}
+		buf[i], buf[i+1] = out[0], out[1]
+	}
+}
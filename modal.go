@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+type modalModel struct {
+	ratios []float64
+	decays []float64 // relative to the decay argument
+}
+
+var modalModels = map[string]modalModel{
+	"bar":      {[]float64{1, 3.99, 10.65}, []float64{1, 0.5, 0.25}},
+	"membrane": {[]float64{1, 1.59, 2.14, 2.30, 2.65, 2.92}, []float64{1, 0.7, 0.5, 0.5, 0.4, 0.3}},
+	"bell":     {[]float64{0.56, 0.92, 1.19, 1.71, 2, 2.74, 3, 3.76, 4.07}, []float64{1, 0.9, 0.7, 0.6, 0.5, 0.4, 0.35, 0.3, 0.25}},
+	"metal":    {[]float64{1, 2.76, 5.40, 8.93, 13.34}, []float64{1, 0.8, 0.6, 0.5, 0.4}},
+}
+
+// ModalSynth excites a bank of tuned resonators with a short strike.
+type ModalSynth struct {
+	ratios   []float64
+	decays   []float64 // seconds
+	hardness float64   // 0..1, brightness of the strike
+	note     float64   // key of the first note character
+	gain     float64
+}
+
+func modalSynthFactory(args string) (Processor, error) {
+	a := parseArgs(args, "model", "decay", "hardness", "note", "ratios", "decays", "gain")
+	name := a.String("model", "bar")
+	model, ok := modalModels[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown modal model: %s", name)
+	}
+	decay := a.Float("decay", 1)
+	s := &ModalSynth{
+		ratios:   a.Floats("ratios", model.ratios),
+		hardness: a.Float("hardness", 0.5),
+		note:     a.Key("note", 60),
+		gain:     a.Float("gain", 0.5),
+	}
+	relDecays := a.Floats("decays", model.decays)
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	if s.hardness < 0 || s.hardness > 1 {
+		return nil, fmt.Errorf("invalid hardness value: %g", s.hardness)
+	}
+	relDecays = extend(relDecays, len(s.ratios))
+	for k := range s.ratios {
+		s.decays = append(s.decays, decay*relDecays[k])
+	}
+	return s, nil
+}
+
+func (s *ModalSynth) Process(t *Track, buf SampleBuffer) {
+	renderNotes(buf, t.Notes(s.note), func(n Note) Voice {
+		freq := noteFreq(n.Key)
+		v := &modalVoice{
+			strike: int(0.002 * float64(sr)),
+			cutoff: 500 + s.hardness*12000,
+			gain:   s.gain * n.Velocity,
+		}
+		for k, ratio := range s.ratios {
+			w := 2 * math.Pi * freq * ratio / float64(sr)
+			if w >= math.Pi {
+				continue
+			}
+			r := math.Exp(-1 / (s.decays[k] * float64(sr)))
+			weight := math.Pow(s.hardness, float64(k)/2)
+			v.modes = append(v.modes, resonator{
+				a1:     2 * r * math.Cos(w),
+				a2:     -r * r,
+				gain:   math.Sin(w) * weight,
+				weight: weight,
+			})
+		}
+		total := 0.0
+		for _, m := range v.modes {
+			total += m.weight
+		}
+		if total > 0 {
+			v.gain /= total
+		}
+		return v
+	})
+}
+
+// resonator is a two-pole filter ringing at a single mode
+type resonator struct {
+	a1, a2 float64
+	y1, y2 float64
+	gain   float64
+	weight float64 // share of the mode in the output
+}
+
+func (r *resonator) Process(x float64) float64 {
+	y := x + r.a1*r.y1 + r.a2*r.y2
+	r.y2, r.y1 = r.y1, y
+	return y * r.gain
+}
+
+type modalVoice struct {
+	modes  []resonator
+	filter SVF
+	age    int
+	strike int     // length of the strike (frames)
+	cutoff float64 // strike brightness (Hz)
+	peak   float64 // recent output peak, for detecting silence
+	gain   float64
+}
+
+func (v *modalVoice) Next(gate bool) (l, r float64) {
+	in := 0.0
+	if v.age < v.strike {
+		impulse := 0.0
+		if v.age == 0 {
+			impulse = 1
+		}
+		in, _, _ = v.filter.Process(impulse, v.cutoff, 0)
+	}
+	v.age++
+	out := 0.0
+	for i := range v.modes {
+		out += v.modes[i].Process(in)
+	}
+	out *= v.gain
+	v.peak = max(v.peak*0.999, math.Abs(out))
+	return out, out
+}
+
+func (v *modalVoice) Done() bool {
+	return v.age > v.strike && v.peak < 1e-5
+}
+
+func (v *modalVoice) OneShot() {}
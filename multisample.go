@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// name of the optional mapping file in multisample directories
+const keymapFile = "keymap.txt"
+
+// Zone is a sample mapped to a range of keys.
+type Zone struct {
+	sample *Sample
+	root   float64 // key at which the sample plays at original pitch
+	low    float64
+	high   float64
+}
+
+// parseKey parses a key given as MIDI number, expression or note name
+func parseKey(s string) (float64, error) {
+	if key, err := parseFloat(s); err == nil {
+		return key, nil
+	}
+	return parseNoteName(s)
+}
+
+// loadKeymap reads zones from a mapping file with lines of the form
+// "<file> <root> [<low> <high>]".
+func loadKeymap(dir string) ([]*Zone, error) {
+	f, err := os.Open(filepath.Join(dir, keymapFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var zones []*Zone
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 && len(fields) != 4 {
+			return nil, fmt.Errorf("invalid keymap line: %s", scanner.Text())
+		}
+		z := &Zone{}
+		if z.sample, err = loadSample(filepath.Join(dir, fields[0])); err != nil {
+			return nil, err
+		}
+		if z.root, err = parseKey(fields[1]); err != nil {
+			return nil, err
+		}
+		z.low, z.high = math.Inf(-1), math.Inf(1)
+		if len(fields) == 4 {
+			if z.low, err = parseKey(fields[2]); err != nil {
+				return nil, err
+			}
+			if z.high, err = parseKey(fields[3]); err != nil {
+				return nil, err
+			}
+		}
+		zones = append(zones, z)
+	}
+	return zones, scanner.Err()
+}
+
+// matches the root key at the end of a sample file name, e.g. piano_C4.wav
+var zoneNamePattern = regexp.MustCompile(`([A-Ga-g][#b]?-?[0-9]|[0-9]+)\.[Ww][Aa][Vv]$`)
+
+// loadZones derives zones from the file names of the WAVs in dir
+func loadZones(dir string) ([]*Zone, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var zones []*Zone
+	for _, entry := range entries {
+		matches := zoneNamePattern.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			continue
+		}
+		root, err := parseKey(matches[1])
+		if err != nil {
+			return nil, err
+		}
+		sample, err := loadSample(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		zones = append(zones, &Zone{
+			sample: sample,
+			root:   root,
+			low:    math.Inf(-1),
+			high:   math.Inf(1),
+		})
+	}
+	return zones, nil
+}
+
+type MultiSample struct {
+	zones []*Zone
+	note  float64 // key of the first note character
+	adsr  ADSR
+	gain  float64
+}
+
+func multiSampleFactory(args string) (Processor, error) {
+	a := parseArgs(args, "path", "note", "attack", "decay", "sustain", "release", "gain")
+	path := a.String("path", "")
+	if path == "" {
+		return nil, fmt.Errorf("missing multisample directory")
+	}
+	m := &MultiSample{
+		note: a.Key("note", 60),
+		adsr: ADSR{
+			Attack:  a.Float("attack", 0),
+			Decay:   a.Float("decay", 0),
+			Sustain: a.Float("sustain", 1),
+			Release: a.Float("release", 0.2),
+		},
+		gain: a.Float("gain", 1),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	dir := songPath(path)
+	zones, err := loadKeymap(dir)
+	if os.IsNotExist(err) {
+		zones, err = loadZones(dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(zones) == 0 {
+		return nil, fmt.Errorf("no samples found in %s", path)
+	}
+	m.zones = zones
+	return m, nil
+}
+
+// zone returns the zone mapped to key, falling back to the zone with
+// the nearest root
+func (m *MultiSample) zone(key float64) *Zone {
+	var best *Zone
+	for _, z := range m.zones {
+		if key < z.low || key > z.high {
+			continue
+		}
+		if best == nil || math.Abs(z.root-key) < math.Abs(best.root-key) {
+			best = z
+		}
+	}
+	if best != nil {
+		return best
+	}
+	for _, z := range m.zones {
+		if best == nil || math.Abs(z.root-key) < math.Abs(best.root-key) {
+			best = z
+		}
+	}
+	return best
+}
+
+func (m *MultiSample) Process(t *Track, buf SampleBuffer) {
+	renderNotes(buf, t.Notes(m.note), func(n Note) Voice {
+		z := m.zone(n.Key)
+		return &multiSampleVoice{
+			sampleVoice: sampleVoice{
+				sample: z.sample,
+				rate:   keyRatio(n.Key, z.root) * float64(z.sample.rate) / float64(sr),
+				gain:   m.gain * n.Velocity,
+			},
+			env: NewEnvelope(m.adsr),
+		}
+	})
+}
+
+type multiSampleVoice struct {
+	sampleVoice
+	env *Envelope
+}
+
+func (v *multiSampleVoice) Next(gate bool) (l, r float64) {
+	l, r = v.sampleVoice.Next(gate)
+	amp := v.env.Next(gate)
+	return l * amp, r * amp
+}
+
+func (v *multiSampleVoice) Done() bool {
+	return v.sampleVoice.Done() || v.env.Done()
+}
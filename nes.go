@@ -0,0 +1,260 @@
+package main
+
+import (
+	"math"
+)
+
+// NTSC CPU clock of the NES (Hz)
+const nesClock = 1789773
+
+// data line codes of the NES channels
+const (
+	nesPulse1Code   = 'p'
+	nesPulse2Code   = 'q'
+	nesTriangleCode = 't'
+	nesNoiseCode    = 'z'
+	nesDPCMCode     = 'd'
+)
+
+// pulse duty cycles selectable by the duty arguments
+var nesDuties = [4]float64{0.125, 0.25, 0.5, 0.75}
+
+// noise timer periods (CPU cycles) selected by hex digits in the noise line
+var nesNoisePeriods = [16]float64{4, 8, 16, 32, 64, 96, 128, 160, 202, 254, 380, 508, 762, 1016, 2034, 4068}
+
+// NES emulates the 2A03 APU: two pulse channels, a triangle, a noise
+// channel and a delta-modulation sample channel, each driven by its own
+// data line and combined through the APU's non-linear mixer.
+type NES struct {
+	note  float64 // key of the first note character
+	duty1 float64
+	duty2 float64
+	decay float64 // volume envelope decay (seconds), 0 = sustain
+	dpcm  []float64
+	rate  float64 // DPCM playback rate (Hz)
+	gain  float64
+}
+
+func nesFactory(args string) (Processor, error) {
+	a := parseArgs(args, "note", "duty1", "duty2", "decay", "dpcm", "rate", "gain")
+	duty1 := a.Int("duty1", 2)
+	duty2 := a.Int("duty2", 1)
+	p := &NES{
+		note:  a.Key("note", 48),
+		duty1: nesDuties[min(max(duty1, 0), 3)],
+		duty2: nesDuties[min(max(duty2, 0), 3)],
+		decay: a.Float("decay", 0),
+		rate:  a.Float("rate", 33144),
+		gain:  a.Float("gain", 1),
+	}
+	path := a.String("dpcm", "")
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	if path != "" {
+		sample, err := loadSample(path)
+		if err != nil {
+			return nil, err
+		}
+		p.dpcm = encodeDPCM(sample, p.rate)
+	}
+	return p, nil
+}
+
+// encodeDPCM resamples s to rate and converts it to the 1-bit delta
+// encoding of the DMC channel, returning the decoded 7-bit levels.
+func encodeDPCM(s *Sample, rate float64) []float64 {
+	mono := s.Mono()
+	step := float64(s.rate) / rate
+	level := 64.0
+	var levels []float64
+	for pos := 0.0; int(pos) < len(mono); pos += step {
+		target := (mono[int(pos)] + 1) * 63.5
+		if target > level && level <= 125 {
+			level += 2
+		} else if target < level && level >= 2 {
+			level -= 2
+		}
+		levels = append(levels, level)
+	}
+	return levels
+}
+
+// nesTimerFreq quantizes freq to what an 11-bit APU timer dividing the
+// CPU clock by div*(t+1) can produce
+func nesTimerFreq(freq, div float64) float64 {
+	t := min(max(math.Round(nesClock/(div*freq))-1, 8), 2047)
+	return nesClock / (div * (t + 1))
+}
+
+func (p *NES) volume(n Note) *nesVolume {
+	return &nesVolume{level: math.Round(n.Velocity * 15), decay: p.decay}
+}
+
+func (p *NES) Process(t *Track, buf SampleBuffer) {
+	frames := len(buf) / nchannels
+	pulses := NewSampleBuffer(frames)
+	triangle := NewSampleBuffer(frames)
+	noise := NewSampleBuffer(frames)
+	dmc := NewSampleBuffer(frames)
+	for _, ch := range []struct {
+		code rune
+		duty float64
+	}{{nesPulse1Code, p.duty1}, {nesPulse2Code, p.duty2}} {
+		renderNotes(pulses, t.NoteLine(ch.code, p.note), func(n Note) Voice {
+			return &nesPulseVoice{
+				duty: ch.duty,
+				freq: nesTimerFreq(noteFreq(n.Key), 16),
+				vol:  p.volume(n),
+			}
+		})
+	}
+	renderNotes(triangle, t.NoteLine(nesTriangleCode, p.note), func(n Note) Voice {
+		return &nesTriangleVoice{freq: nesTimerFreq(noteFreq(n.Key), 32)}
+	})
+	for _, n := range t.Triggers(nesNoiseCode) {
+		period := nesNoisePeriods[8]
+		if d := hexDigit(t.StepData(nesNoiseCode, n.Step)); d != -1 {
+			period = nesNoisePeriods[d]
+		}
+		renderNotes(noise, []Note{n}, func(n Note) Voice {
+			return &nesNoiseVoice{
+				rate: nesClock / period / float64(sr),
+				lfsr: 1,
+				vol:  &nesVolume{level: 15, decay: max(p.decay, 0.1)},
+			}
+		})
+	}
+	if p.dpcm != nil {
+		renderNotes(dmc, t.Triggers(nesDPCMCode), func(n Note) Voice {
+			return &nesDMCVoice{levels: p.dpcm, rate: p.rate / float64(sr)}
+		})
+	}
+	var dc DCBlocker
+	for i := 0; i < frames; i++ {
+		j := i * nchannels
+		var pulseOut, tndOut float64
+		if pulses[j] > 0 {
+			pulseOut = 95.88 / (8128/pulses[j] + 100)
+		}
+		if tnd := triangle[j]/8227 + noise[j]/12241 + dmc[j]/22638; tnd > 0 {
+			tndOut = 159.79 / (1/tnd + 100)
+		}
+		out := dc.Process(pulseOut+tndOut) * p.gain
+		buf[j] += out
+		buf[j+1] += out
+	}
+}
+
+// nesVolume is the 4-bit channel volume, optionally decaying to zero
+type nesVolume struct {
+	level float64
+	decay float64
+	age   int
+}
+
+func (v *nesVolume) Next() float64 {
+	level := v.level
+	if v.decay > 0 {
+		level = math.Ceil(v.level * max(1-float64(v.age)/(v.decay*float64(sr)), 0))
+	}
+	v.age++
+	return level
+}
+
+type nesPulseVoice struct {
+	duty     float64
+	freq     float64
+	phase    float64
+	vol      *nesVolume
+	released bool
+}
+
+func (v *nesPulseVoice) Next(gate bool) (l, r float64) {
+	v.released = !gate
+	level := v.vol.Next()
+	out := 0.0
+	if gate && v.phase < v.duty {
+		out = level
+	}
+	v.phase += v.freq / float64(sr)
+	v.phase -= math.Floor(v.phase)
+	return out, out
+}
+
+func (v *nesPulseVoice) Done() bool {
+	return v.released
+}
+
+type nesTriangleVoice struct {
+	freq     float64
+	phase    float64
+	last     float64
+	released bool
+}
+
+// the triangle channel steps through a 32-step 4-bit sequence
+func (v *nesTriangleVoice) Next(gate bool) (l, r float64) {
+	v.released = !gate
+	if gate {
+		step := math.Floor(v.phase * 32)
+		if step < 16 {
+			v.last = 15 - step
+		} else {
+			v.last = step - 16
+		}
+		v.phase += v.freq / float64(sr)
+		v.phase -= math.Floor(v.phase)
+	}
+	return v.last, v.last
+}
+
+func (v *nesTriangleVoice) Done() bool {
+	return v.released
+}
+
+type nesNoiseVoice struct {
+	rate  float64 // LFSR clocks per frame
+	acc   float64
+	lfsr  uint16
+	vol   *nesVolume
+	level float64
+}
+
+func (v *nesNoiseVoice) Next(gate bool) (l, r float64) {
+	v.acc += v.rate
+	for ; v.acc >= 1; v.acc-- {
+		feedback := (v.lfsr ^ v.lfsr>>1) & 1
+		v.lfsr = v.lfsr>>1 | feedback<<14
+	}
+	v.level = v.vol.Next()
+	out := 0.0
+	if v.lfsr&1 == 0 {
+		out = v.level
+	}
+	return out, out
+}
+
+func (v *nesNoiseVoice) Done() bool {
+	return v.vol.decay > 0 && v.vol.age > 0 && v.level == 0
+}
+
+func (v *nesNoiseVoice) OneShot() {}
+
+type nesDMCVoice struct {
+	levels []float64
+	pos    float64
+	rate   float64
+}
+
+func (v *nesDMCVoice) Next(gate bool) (l, r float64) {
+	out := v.levels[min(int(v.pos), len(v.levels)-1)]
+	v.pos += v.rate
+	return out, out
+}
+
+func (v *nesDMCVoice) Done() bool {
+	return int(v.pos) >= len(v.levels)
+}
+
+func (v *nesDMCVoice) OneShot() {}
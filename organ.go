@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// pitch ratios of the drawbars: 16', 5 1/3', 8', 4', 2 2/3', 2', 1 3/5',
+// 1 1/3' and 1'
+var drawbarRatios = [9]float64{0.5, 1.5, 1, 2, 3, 4, 5, 6, 8}
+
+// Organ is a tonewheel style organ. Drawbars are given as nine digits
+// 0-8 like on the real instrument, e.g. 888000000.
+type Organ struct {
+	drawbars [9]float64
+	perc     float64 // level of the decaying second harmonic percussion
+	click    float64 // level of the key click
+	rotary   float64 // rotary speaker speed (Hz), 0 = off
+	note     float64 // key of the first note character
+	gain     float64
+}
+
+func organFactory(args string) (Processor, error) {
+	a := parseArgs(args, "drawbars", "perc", "click", "rotary", "note", "gain")
+	o := &Organ{
+		perc:   a.Float("perc", 0),
+		click:  a.Float("click", 0.3),
+		rotary: a.Float("rotary", 0),
+		note:   a.Key("note", 60),
+		gain:   a.Float("gain", 0.3),
+	}
+	drawbars := a.String("drawbars", "888000000")
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	if len(drawbars) != 9 {
+		return nil, fmt.Errorf("drawbars need nine digits: %s", drawbars)
+	}
+	total := 0.0
+	for i := range o.drawbars {
+		c := drawbars[i]
+		if c < '0' || c > '8' {
+			return nil, fmt.Errorf("invalid drawbar setting: %s", drawbars)
+		}
+		o.drawbars[i] = float64(c-'0') / 8
+		total += o.drawbars[i]
+	}
+	if total > 1 {
+		o.gain /= math.Sqrt(total)
+	}
+	return o, nil
+}
+
+func (o *Organ) Process(t *Track, buf SampleBuffer) {
+	out := buf
+	if o.rotary > 0 {
+		out = NewSampleBuffer(len(buf) / nchannels)
+	}
+	renderNotes(out, t.Notes(o.note), func(n Note) Voice {
+		return &organVoice{
+			organ: o,
+			freq:  noteFreq(n.Key),
+			env:   NewEnvelope(ADSR{Attack: 0.005, Sustain: 1, Release: 0.01}),
+			perc:  NewDecay(0.3),
+			click: NewDecay(0.003),
+			gain:  o.gain * n.Velocity,
+		}
+	})
+	if o.rotary > 0 {
+		o.applyRotary(out)
+		for i := range buf {
+			buf[i] += out[i]
+		}
+	}
+}
+
+// applyRotary simulates a rotating horn: the signal is doppler shifted
+// and panned around the stereo field
+func (o *Organ) applyRotary(buf SampleBuffer) {
+	depth := 0.0006 * float64(sr)
+	delay := NewDelayLine(int(2*depth) + 1)
+	lfo := NewLFO(Sine, o.rotary)
+	for i := 0; i < len(buf); i += nchannels {
+		delay.Write((buf[i] + buf[i+1]) / 2)
+		m := lfo.Next()
+		x := delay.Read(depth * (1 + m))
+		buf[i] = x * (1 + 0.5*m) / 1.5
+		buf[i+1] = x * (1 - 0.5*m) / 1.5
+	}
+}
+
+type organVoice struct {
+	organ  *Organ
+	phases [9]float64
+	freq   float64
+	env    *Envelope
+	perc   *Decay
+	click  *Decay
+	noise  Noise
+	gain   float64
+}
+
+func (v *organVoice) Next(gate bool) (l, r float64) {
+	out := 0.0
+	for i, ratio := range drawbarRatios {
+		level := v.organ.drawbars[i]
+		if i == 3 {
+			level += v.organ.perc * v.perc.Next()
+		}
+		if level == 0 {
+			continue
+		}
+		freq := v.freq * ratio
+		if freq >= float64(sr)/2 {
+			continue
+		}
+		out += math.Sin(2*math.Pi*v.phases[i]) * level
+		v.phases[i] += freq / float64(sr)
+		v.phases[i] -= math.Floor(v.phases[i])
+	}
+	out += v.noise.Next() * v.click.Next() * v.organ.click
+	out *= v.env.Next(gate) * v.gain
+	return out, out
+}
+
+func (v *organVoice) Done() bool {
+	return v.env.Done()
+}
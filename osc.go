@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+type Waveform int
+
+const (
+	Sine Waveform = iota
+	Saw
+	Square
+	Triangle
+	Pulse
+)
+
+var waveforms = map[string]Waveform{
+	"sine":     Sine,
+	"saw":      Saw,
+	"square":   Square,
+	"triangle": Triangle,
+	"pulse":    Pulse,
+}
+
+func parseWaveform(name string) (Waveform, error) {
+	if wave, ok := waveforms[name]; ok {
+		return wave, nil
+	}
+	return Sine, fmt.Errorf("unknown waveform: %s", name)
+}
+
+// when set, oscillators are rendered without band-limiting
+var naiveOscillators bool
+
+// polyBLEP returns the correction to apply around a discontinuity of
+// a unit step at phase t, with phase increment dt.
+func polyBLEP(t, dt float64) float64 {
+	if t < dt {
+		t /= dt
+		return t + t - t*t - 1
+	} else if t > 1-dt {
+		t = (t - 1) / dt
+		return t*t + t + t + 1
+	}
+	return 0
+}
+
+type Oscillator struct {
+	wave  Waveform
+	phase float64 // 0..1
+	width float64 // pulse width (0..1)
+}
+
+func (o *Oscillator) Next(freq float64) float64 {
+	var out float64
+	dt := freq / float64(sr)
+	switch o.wave {
+	case Sine:
+		out = math.Sin(2 * math.Pi * o.phase)
+	case Saw:
+		out = 2*o.phase - 1
+		if !naiveOscillators {
+			out -= polyBLEP(o.phase, dt)
+		}
+	case Square, Pulse:
+		width := 0.5
+		if o.wave == Pulse && o.width > 0 && o.width < 1 {
+			width = o.width
+		}
+		if o.phase < width {
+			out = 1
+		} else {
+			out = -1
+		}
+		if !naiveOscillators {
+			out += polyBLEP(o.phase, dt)
+			out -= polyBLEP(math.Mod(o.phase+1-width, 1), dt)
+		}
+	case Triangle:
+		out = 1 - 4*math.Abs(o.phase-0.5)
+	}
+	o.phase += dt
+	o.phase -= math.Floor(o.phase)
+	return out
+}
+
+// Unison configures a stack of detuned oscillators playing one note.
+type Unison struct {
+	Voices int
+	Spread float64 // detune between the outermost voices (cents)
+	Width  float64 // stereo spread (0..1)
+}
+
+func parseUnison(a *Args) Unison {
+	return Unison{
+		Voices: max(a.Int("unison", 1), 1),
+		Spread: a.Float("spread", 20),
+		Width:  a.Float("width", 0.5),
+	}
+}
+
+type UnisonOscillator struct {
+	oscs   []Oscillator
+	ratios []float64
+	gainsL []float64
+	gainsR []float64
+}
+
+func NewUnisonOscillator(wave Waveform, u Unison) *UnisonOscillator {
+	o := &UnisonOscillator{}
+	norm := 1 / math.Sqrt(float64(u.Voices))
+	for i := 0; i < u.Voices; i++ {
+		pos := 0.0 // -1..1 across the stack
+		if u.Voices > 1 {
+			pos = 2*float64(i)/float64(u.Voices-1) - 1
+		}
+		pan := pos * u.Width
+		o.oscs = append(o.oscs, Oscillator{
+			wave:  wave,
+			phase: float64(i) / float64(u.Voices),
+		})
+		o.ratios = append(o.ratios, math.Pow(2, pos*u.Spread/2/1200))
+		o.gainsL = append(o.gainsL, (1-pan)*norm)
+		o.gainsR = append(o.gainsR, (1+pan)*norm)
+	}
+	return o
+}
+
+func (o *UnisonOscillator) Next(freq float64) (l, r float64) {
+	for i := range o.oscs {
+		out := o.oscs[i].Next(freq * o.ratios[i])
+		l += out * o.gainsL[i]
+		r += out * o.gainsR[i]
+	}
+	return l, r
+}
+
+type oscVoice struct {
+	osc  *UnisonOscillator
+	freq float64
+	env  *Envelope
+	gain float64
+}
+
+func (v *oscVoice) Next(gate bool) (l, r float64) {
+	l, r = v.osc.Next(v.freq)
+	amp := v.env.Next(gate) * v.gain
+	return l * amp, r * amp
+}
+
+func (v *oscVoice) Done() bool {
+	return v.env.Done()
+}
+
+type OscSynth struct {
+	wave   Waveform
+	unison Unison
+	note   float64 // key of the first note character
+	detune float64 // cents
+	adsr   ADSR
+	gain   float64
+}
+
+func oscSynthFactory(args string) (Processor, error) {
+	a := parseArgs(args, "wave", "note", "detune", "attack", "decay", "sustain", "release", "gain", "freq",
+		"unison", "spread", "width")
+	wave, err := parseWaveform(a.String("wave", "sine"))
+	if err != nil {
+		return nil, err
+	}
+	s := &OscSynth{
+		wave:   wave,
+		unison: parseUnison(a),
+		note:   a.Key("note", 60),
+		detune: a.Float("detune", 0),
+		adsr: ADSR{
+			Attack:  a.Float("attack", 0.005),
+			Decay:   a.Float("decay", 0.1),
+			Sustain: a.Float("sustain", 0.7),
+			Release: a.Float("release", 0.1),
+		},
+		gain: a.Float("gain", 0.3),
+	}
+	if freq := a.Float("freq", 0); freq > 0 {
+		s.note = 69 + 12*math.Log2(freq/440)
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *OscSynth) Process(t *Track, buf SampleBuffer) {
+	renderNotes(buf, t.Notes(s.note+s.detune/100), func(n Note) Voice {
+		return &oscVoice{
+			osc:  NewUnisonOscillator(s.wave, s.unison),
+			freq: noteFreq(n.Key),
+			env:  NewEnvelope(s.adsr),
+			gain: s.gain * n.Velocity,
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// matches references to the data lines of named patterns like @hats or
+// @verse/bass in data lines; like variables, they can be enclosed in
+// braces to separate them from steps following them, e.g. @{hats}x.x.
+var patternRefPattern = regexp.MustCompile(`@(?:(\w+)(?:/(\w+))?|\{(\w+)(?:/(\w+))?\})`)
+
+// refData returns the data line code of a named pattern: of its track
+// called trackName if given, otherwise of its first track having one
+func refData(p Pattern, code rune, trackName string) (string, bool) {
+	for _, t := range p {
+		if trackName != "" && t.name != trackName {
+			continue
+		}
+		if data, ok := t.data[code]; ok {
+			return data, true
+		}
+	}
+	return "", false
+}
+
+// expandPatternRefs replaces the pattern references in data line code
+// with the data of the same line in the referenced patterns
+func expandPatternRefs(data string, code rune, named map[string]Song) (string, error) {
+	var err error
+	data = patternRefPattern.ReplaceAllStringFunc(data, func(ref string) string {
+		m := patternRefPattern.FindStringSubmatch(ref)
+		name, trackName := m[1]+m[3], m[2]+m[4]
+		song, ok := named[name]
+		if !ok {
+			if err == nil {
+				err = fmt.Errorf("unknown pattern: %s", name)
+			}
+			return ""
+		}
+		value, ok := refData(song[0], code, trackName)
+		if !ok && err == nil {
+			err = fmt.Errorf("no %c line in pattern reference: %s", code, ref)
+		}
+		return value
+	})
+	return data, err
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// maximum number of phaser allpass stages
+const phaserStages = 12
+
+// Phaser sweeps the notches of a chain of first-order allpass filters
+// mixed with the dry signal.
+type Phaser struct {
+	stages   int
+	period   Duration // LFO period
+	low      float64  // lowest notch frequency (Hz)
+	depth    float64  // sweep range (octaves)
+	feedback float64
+	mix      float64 // dry/wet (0..1)
+	lfo      *LFO
+	state    [2][phaserStages]float64
+	last     [2]float64
+}
+
+func phaserFactory(args string) (Processor, error) {
+	a := parseArgs(args, "stages", "period", "depth", "feedback", "low", "mix")
+	p := &Phaser{
+		stages:   min(max(a.Int("stages", 4), 1), phaserStages),
+		period:   a.Duration("period", "16"),
+		depth:    a.Float("depth", 4),
+		feedback: a.Float("feedback", 0.5),
+		low:      a.Float("low", 200),
+		mix:      a.Float("mix", 0.5),
+		lfo:      NewLFO(Sine, 0),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	if math.Abs(p.feedback) >= 1 {
+		return nil, fmt.Errorf("invalid feedback value: %g", p.feedback)
+	}
+	if p.low <= 0 {
+		return nil, fmt.Errorf("invalid low value: %g", p.low)
+	}
+	return p, nil
+}
+
+func (p *Phaser) Process(t *Track, buf SampleBuffer) {
+	p.lfo.Sync(t, p.period)
+	for i := 0; i < len(buf); i += nchannels {
+		freq := min(p.low*math.Pow(2, p.depth*(p.lfo.Next()+1)/2), 0.45*float64(sr))
+		g := math.Tan(math.Pi * freq / float64(sr))
+		coef := (g - 1) / (g + 1)
+		for c := range p.state {
+			x := buf[i+c]
+			y := x + p.last[c]*p.feedback
+			for s := 0; s < p.stages; s++ {
+				// first-order allpass in transposed direct form II
+				out := coef*y + p.state[c][s]
+				p.state[c][s] = y - coef*out
+				y = out
+			}
+			p.last[c] = y
+			buf[i+c] = x*(1-p.mix) + y*p.mix
+		}
+	}
+}
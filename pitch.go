@@ -0,0 +1,73 @@
+package main
+
+import (
+	"math"
+)
+
+// PitchShifter shifts the pitch of a signal by reading it from a delay
+// line with two taps sweeping at the rate giving the pitch ratio,
+// crossfaded so that each tap is silent when it jumps back.
+type PitchShifter struct {
+	line   *DelayLine
+	window float64 // frames
+	phase  float64
+}
+
+func NewPitchShifter(window float64) *PitchShifter {
+	window = max(window, 4)
+	return &PitchShifter{
+		line:   NewDelayLine(int(window) + 2),
+		window: window,
+	}
+}
+
+func (p *PitchShifter) Process(x, ratio float64) float64 {
+	p.line.Write(x)
+	p.phase = math.Mod(p.phase+(1-ratio)/p.window+1, 1)
+	var y float64
+	for _, phase := range []float64{p.phase, math.Mod(p.phase+0.5, 1)} {
+		w := math.Sin(math.Pi * phase)
+		y += p.line.Read(1+phase*(p.window-1)) * w * w
+	}
+	return y
+}
+
+// largest pitch shift in semitones either way
+const maxShift = 48
+
+// clampShift limits a pitch shift to maxShift semitones
+func clampShift(semitones float64) float64 {
+	return min(max(semitones, -maxShift), maxShift)
+}
+
+// Pitch shifts the pitch of the pattern buffer.
+type Pitch struct {
+	ratio    float64
+	mix      float64 // dry/wet (0..1)
+	shifters [2]*PitchShifter
+}
+
+func pitchFactory(args string) (Processor, error) {
+	a := parseArgs(args, "semitones", "cents", "window", "mix")
+	semitones := a.Float("semitones", 12)
+	cents := a.Float("cents", 0)
+	window := min(a.Float("window", 0.05), 1) * float64(sr)
+	p := &Pitch{
+		ratio: math.Pow(2, clampShift(semitones+cents/100)/12),
+		mix:   a.Float("mix", 1),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	p.shifters = [2]*PitchShifter{NewPitchShifter(window), NewPitchShifter(window)}
+	return p, nil
+}
+
+func (p *Pitch) Process(t *Track, buf SampleBuffer) {
+	for i := 0; i < len(buf); i += nchannels {
+		for c := range p.shifters {
+			x := buf[i+c]
+			buf[i+c] = x*(1-p.mix) + p.shifters[c].Process(x, p.ratio)*p.mix
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// sine returns a buffer of a sine wave of freq Hz on both channels
+func sine(freq float64, frames int) SampleBuffer {
+	buf := NewSampleBuffer(frames)
+	for i := 0; i < len(buf); i += nchannels {
+		x := math.Sin(2 * math.Pi * freq * float64(i/nchannels) / float64(sr))
+		buf[i], buf[i+1] = x, x
+	}
+	return buf
+}
+
+// crossings counts the zero crossings of the left channel of buf
+func crossings(buf SampleBuffer) int {
+	n := 0
+	for i := nchannels; i < len(buf); i += nchannels {
+		if (buf[i-nchannels] < 0) != (buf[i] < 0) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestPitchShiftsFrequency(t *testing.T) {
+	for _, test := range []struct {
+		args  string
+		ratio float64
+	}{
+		{"semitones=12", 2},
+		{"semitones=-12", 0.5},
+		{"semitones=7", 1.5},
+	} {
+		proc, err := pitchFactory(test.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := sine(220, int(sr)/2)
+		want := float64(crossings(buf[len(buf)/2:])) * test.ratio
+		proc.Process(testTrack(), buf)
+		if got := float64(crossings(buf[len(buf)/2:])); math.Abs(got-want) > want/10 {
+			t.Errorf("%s: got %g zero crossings, want about %g", test.args, got, want)
+		}
+	}
+}
+
+func TestPitchShiftersStayFinite(t *testing.T) {
+	for _, test := range []struct {
+		factory ProcessorFactory
+		args    string
+	}{
+		{pitchFactory, ""},
+		{pitchFactory, "semitones=10000:window=1e9"},
+		{pitchFactory, "semitones=-10000"},
+		{grainDelayFactory, ""},
+		{grainDelayFactory, "pitch=1e6:size=1e9:scatter=1e9:time=1e9"},
+		{grainDelayFactory, "pitch=-1e6:time=1e9b"},
+		{shimmerFactory, ""},
+		{shimmerFactory, "shift=10000"},
+	} {
+		proc, err := test.factory(test.args)
+		if err != nil {
+			t.Fatalf("%s: %v", test.args, err)
+		}
+		buf := sine(800, 4800)
+		proc.Process(testTrack(), buf)
+		for i, x := range buf {
+			if math.IsNaN(x) || math.IsInf(x, 0) {
+				t.Errorf("%s: sample %d is %g", test.args, i, x)
+				break
+			}
+		}
+	}
+}
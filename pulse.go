@@ -0,0 +1,64 @@
+package main
+
+// PulseSynth is a pulse oscillator whose width can be swept by an LFO.
+type PulseSynth struct {
+	note  float64 // key of the first note character
+	width float64 // pulse width (0..1)
+	rate  float64 // width LFO rate (Hz)
+	depth float64 // width LFO depth
+	adsr  ADSR
+	gain  float64
+}
+
+func pulseSynthFactory(args string) (Processor, error) {
+	a := parseArgs(args, "note", "width", "rate", "depth", "attack", "decay", "sustain", "release", "gain")
+	s := &PulseSynth{
+		note:  a.Key("note", 48),
+		width: a.Float("width", 0.5),
+		rate:  a.Float("rate", 0),
+		depth: a.Float("depth", 0),
+		adsr: ADSR{
+			Attack:  a.Float("attack", 0.005),
+			Decay:   a.Float("decay", 0.1),
+			Sustain: a.Float("sustain", 0.7),
+			Release: a.Float("release", 0.1),
+		},
+		gain: a.Float("gain", 0.3),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *PulseSynth) Process(t *Track, buf SampleBuffer) {
+	renderNotes(buf, t.Notes(s.note), func(n Note) Voice {
+		return &pulseVoice{
+			synth: s,
+			osc:   Oscillator{wave: Pulse},
+			lfo:   NewLFO(Triangle, s.rate),
+			freq:  noteFreq(n.Key),
+			env:   NewEnvelope(s.adsr),
+			gain:  s.gain * n.Velocity,
+		}
+	})
+}
+
+type pulseVoice struct {
+	synth *PulseSynth
+	osc   Oscillator
+	lfo   *LFO
+	freq  float64
+	env   *Envelope
+	gain  float64
+}
+
+func (v *pulseVoice) Next(gate bool) (l, r float64) {
+	v.osc.width = min(max(v.synth.width+v.synth.depth*v.lfo.Next(), 0.01), 0.99)
+	out := v.osc.Next(v.freq) * v.env.Next(gate) * v.gain
+	return out, out
+}
+
+func (v *pulseVoice) Done() bool {
+	return v.env.Done()
+}
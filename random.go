@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// matches random expressions like rand(1,4) or choose(x...,x.x.) which
+// contain no further parentheses
+var randomPattern = regexp.MustCompile(`(rand|choose)\(([^()]*)\)`)
+
+// expandRandom replaces the random expressions of a song line with
+// values drawn from rng: rand(lo,hi) is a number between lo and hi,
+// an integer if both are, and choose(a,b,...) one of its arguments.
+// Nested expressions are expanded from the inside out.
+func expandRandom(line string, rng *rand.Rand) (string, error) {
+	var err error
+	for err == nil && randomPattern.MatchString(line) {
+		line = randomPattern.ReplaceAllStringFunc(line, func(expr string) string {
+			m := randomPattern.FindStringSubmatch(expr)
+			args := strings.Split(m[2], ",")
+			if m[1] == "choose" {
+				return strings.TrimSpace(args[rng.Intn(len(args))])
+			}
+			value, e := randomValue(args, rng)
+			if e != nil && err == nil {
+				err = fmt.Errorf("invalid random expression: %s", expr)
+			}
+			return value
+		})
+	}
+	return line, err
+}
+
+func randomValue(args []string, rng *rand.Rand) (string, error) {
+	if len(args) != 2 {
+		return "", fmt.Errorf("wrong number of arguments")
+	}
+	lo, hi := strings.TrimSpace(args[0]), strings.TrimSpace(args[1])
+	if l, err := strconv.Atoi(lo); err == nil {
+		if h, err := strconv.Atoi(hi); err == nil && h >= l {
+			return strconv.Itoa(l + rng.Intn(h-l+1)), nil
+		}
+	}
+	l, err := parseFloat(lo)
+	if err != nil {
+		return "", err
+	}
+	h, err := parseFloat(hi)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(l+(h-l)*rng.Float64(), 'g', 6, 64), nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import "fmt"
+
+// Freeverb tunings (frames at 44.1 kHz)
+var (
+	reverbCombTunings    = []int{1116, 1188, 1277, 1356, 1422, 1491, 1557, 1617}
+	reverbAllpassTunings = []int{556, 441, 341, 225}
+)
+
+// offset of the right channel tunings
+const reverbStereoSpread = 23
+
+type combFilter struct {
+	buf      []float64
+	pos      int
+	store    float64
+	feedback float64
+	damp     float64
+}
+
+func (c *combFilter) Process(x float64) float64 {
+	out := c.buf[c.pos]
+	c.store = out*(1-c.damp) + c.store*c.damp
+	c.buf[c.pos] = x + c.store*c.feedback
+	c.pos = (c.pos + 1) % len(c.buf)
+	return out
+}
+
+type allpassFilter struct {
+	buf []float64
+	pos int
+}
+
+func (a *allpassFilter) Process(x float64) float64 {
+	delayed := a.buf[a.pos]
+	out := delayed - x
+	a.buf[a.pos] = x + delayed*0.5
+	a.pos = (a.pos + 1) % len(a.buf)
+	return out
+}
+
+// Freeverb is a mono-in/mono-out Schroeder-Moorer reverberator.
+type Freeverb struct {
+	combs     []combFilter
+	allpasses []allpassFilter
+}
+
+func NewFreeverb(size, damp float64, spread int) *Freeverb {
+	f := &Freeverb{}
+	scale := float64(sr) / 44100
+	for _, tuning := range reverbCombTunings {
+		f.combs = append(f.combs, combFilter{
+			buf:      make([]float64, int(float64(tuning+spread)*scale)),
+			feedback: 0.7 + 0.28*size,
+			damp:     damp * 0.4,
+		})
+	}
+	for _, tuning := range reverbAllpassTunings {
+		f.allpasses = append(f.allpasses, allpassFilter{
+			buf: make([]float64, int(float64(tuning+spread)*scale)),
+		})
+	}
+	return f
+}
+
+func (f *Freeverb) Process(x float64) float64 {
+	out := 0.0
+	for i := range f.combs {
+		out += f.combs[i].Process(x)
+	}
+	for i := range f.allpasses {
+		out = f.allpasses[i].Process(out)
+	}
+	return out
+}
+
+// Reverb is a stereo Freeverb applied to the pattern buffer.
+type Reverb struct {
+	size     float64 // room size (0..1)
+	damp     float64 // high frequency damping (0..1)
+	predelay float64 // milliseconds
+	mix      float64 // dry/wet (0..1)
+	width    float64 // stereo width of the tail (0..1)
+	verbs    [2]*Freeverb
+	pre      [2]*DelayLine
+}
+
+func reverbFactory(args string) (Processor, error) {
+	a := parseArgs(args, "size", "damp", "predelay", "mix", "width")
+	r := &Reverb{
+		size:     a.Float("size", 0.5),
+		damp:     a.Float("damp", 0.5),
+		predelay: a.Float("predelay", 10),
+		mix:      a.Float("mix", 0.25),
+		width:    a.Float("width", 1),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	if r.size < 0 || r.size > 1 {
+		return nil, fmt.Errorf("invalid size value: %g", r.size)
+	}
+	if r.damp < 0 || r.damp > 1 {
+		return nil, fmt.Errorf("invalid damp value: %g", r.damp)
+	}
+	for c := range r.verbs {
+		r.verbs[c] = NewFreeverb(r.size, r.damp, c*reverbStereoSpread)
+		r.pre[c] = NewDelayLine(int(r.predelay*float64(sr)/1000) + 1)
+	}
+	return r, nil
+}
+
+func (r *Reverb) Process(t *Track, buf SampleBuffer) {
+	predelay := max(r.predelay*float64(sr)/1000, 1)
+	// Freeverb's fixed input gain keeps the comb outputs in range
+	const inputGain = 0.015
+	for i := 0; i < len(buf); i += nchannels {
+		in := (buf[i] + buf[i+1]) * inputGain
+		var wet [2]float64
+		for c := range r.verbs {
+			r.pre[c].Write(in)
+			wet[c] = r.verbs[c].Process(r.pre[c].Read(predelay))
+		}
+		wet1 := (1 + r.width) / 2
+		wet2 := (1 - r.width) / 2
+		l := wet[0]*wet1 + wet[1]*wet2
+		rr := wet[1]*wet1 + wet[0]*wet2
+		buf[i] = buf[i]*(1-r.mix) + l*r.mix
+		buf[i+1] = buf[i+1]*(1-r.mix) + rr*r.mix
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+// RingMod multiplies the buffer with a carrier oscillator.
+type RingMod struct {
+	wave Waveform
+	freq float64 // carrier frequency (Hz)
+	mix  float64 // dry/wet (0..1)
+}
+
+func ringModFactory(args string) (Processor, error) {
+	a := parseArgs(args, "freq", "wave", "mix", "note")
+	wave, err := parseWaveform(a.String("wave", "sine"))
+	if err != nil {
+		return nil, err
+	}
+	r := &RingMod{
+		wave: wave,
+		freq: a.Float("freq", 440),
+		mix:  a.Float("mix", 1),
+	}
+	if note := a.String("note", ""); note != "" {
+		key, err := parseKey(note)
+		if err != nil {
+			return nil, err
+		}
+		r.freq = noteFreq(key)
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RingMod) Process(t *Track, buf SampleBuffer) {
+	carrier := Oscillator{wave: r.wave}
+	for i := 0; i < len(buf); i += nchannels {
+		gain := 1 - r.mix + r.mix*carrier.Next(r.freq)
+		buf[i] *= gain
+		buf[i+1] *= gain
+	}
+}
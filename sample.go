@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-audio/wav"
+	"math"
+	"os"
+)
+
+// Sample is audio loaded from a WAV file, converted to stereo frames.
+type Sample struct {
+	data SampleBuffer
+	rate int
+}
+
+var sampleCache = make(map[string]*Sample)
+
+func loadSample(filename string) (*Sample, error) {
+	path := songPath(filename)
+	if s, ok := sampleCache[path]; ok {
+		return s, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d := wav.NewDecoder(f)
+	if !d.IsValidFile() {
+		return nil, fmt.Errorf("invalid WAV file: %s", filename)
+	}
+	pcm, err := d.FullPCMBuffer()
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode %s: %w", filename, err)
+	}
+	channels := pcm.Format.NumChannels
+	if channels < 1 {
+		return nil, fmt.Errorf("no channels in %s", filename)
+	}
+	scale := float64(int(1) << (pcm.SourceBitDepth - 1))
+	frames := len(pcm.Data) / channels
+	s := &Sample{
+		data: NewSampleBuffer(frames),
+		rate: pcm.Format.SampleRate,
+	}
+	for i := 0; i < frames; i++ {
+		l := float64(pcm.Data[i*channels]) / scale
+		r := l
+		if channels > 1 {
+			r = float64(pcm.Data[i*channels+1]) / scale
+		}
+		s.data[i*nchannels] = l
+		s.data[i*nchannels+1] = r
+	}
+	sampleCache[path] = s
+	return s, nil
+}
+
+func (s *Sample) Frames() int {
+	return len(s.data) / nchannels
+}
+
+// At returns the linearly interpolated frame at fractional position pos.
+func (s *Sample) At(pos float64) (l, r float64) {
+	if pos < 0 {
+		return 0, 0
+	}
+	i := int(pos)
+	if i >= s.Frames() {
+		return 0, 0
+	}
+	frac := pos - math.Floor(pos)
+	l, r = s.data[i*nchannels], s.data[i*nchannels+1]
+	if i+1 < s.Frames() {
+		l += (s.data[(i+1)*nchannels] - l) * frac
+		r += (s.data[(i+1)*nchannels+1] - r) * frac
+	}
+	return l, r
+}
+
+// Mono returns the sample mixed down to a single channel.
+func (s *Sample) Mono() []float64 {
+	out := make([]float64, s.Frames())
+	for i := range out {
+		out[i] = (s.data[i*nchannels] + s.data[i*nchannels+1]) / 2
+	}
+	return out
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// data line code holding per-step sample start offsets
+const offsetCode = 'o'
+
+// SamplePlayer plays a sample on each hit of the trigger line at its
+// original pitch and on each note of the note line repitched by the
+// note's distance from the root key, which '0' plays. Given the tempo or length in beats of a
+// loop, it stretches the sample to the tempo of the track without
+// changing its pitch.
+type SamplePlayer struct {
+	sample *Sample
+	root   float64 // key at which the sample plays at original pitch
+	pitch  float64 // semitones
+	start  float64 // default start position (0..1)
+	bpm    float64 // tempo of the sample, 0 = don't stretch
+	beats  float64 // length of the sample in beats, 0 = don't stretch
+	gain   float64
+}
+
+func samplePlayerFactory(args string) (Processor, error) {
+	a := parseArgs(args, "path", "pitch", "start", "gain", "bpm", "beats", "root")
+	path := a.String("path", "")
+	if path == "" {
+		return nil, fmt.Errorf("missing sample path")
+	}
+	p := &SamplePlayer{
+		root:  a.Key("root", 60),
+		pitch: a.Float("pitch", 0),
+		start: a.Float("start", 0),
+		bpm:   a.Float("bpm", 0),
+		beats: a.Float("beats", 0),
+		gain:  a.Float("gain", 1),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	sample, err := loadSample(path)
+	if err != nil {
+		return nil, err
+	}
+	p.sample = sample
+	return p, nil
+}
+
+// startOffset returns the start position (0..1) for step i: hex digits
+// in the offset line select one of 16 equal slices of the sample.
+func (p *SamplePlayer) startOffset(t *Track, start *Param, i int) float64 {
+	if d := hexDigit(t.StepData(offsetCode, i)); d != -1 {
+		return float64(d) / 16
+	}
+	return start.Step(i)
+}
+
+// stretch returns the factor by which the sample should be lengthened
+// on track t, or 0 if it shouldn't be stretched
+func (p *SamplePlayer) stretch(t *Track) float64 {
+	if p.beats > 0 {
+		length := float64(p.sample.Frames()) * float64(sr) / float64(p.sample.rate)
+		return p.beats * t.SamplesPerBeat() / length
+	}
+	if p.bpm > 0 {
+		return p.bpm / t.bpm
+	}
+	return 0
+}
+
+func (p *SamplePlayer) Process(t *Track, buf SampleBuffer) {
+	stretch := p.stretch(t)
+	start := t.Param("start", p.start, 0, 1)
+	pitch := t.Param("pitch", p.pitch, -12, 12)
+	newVoice := func(n Note) Voice {
+		v := sampleVoice{
+			sample: p.sample,
+			pos:    p.startOffset(t, start, n.Step) * float64(p.sample.Frames()),
+			rate:   keyRatio(n.Key, p.root) * math.Pow(2, pitch.Step(n.Step)/12) * float64(p.sample.rate) / float64(sr),
+			gain:   p.gain * n.Velocity,
+		}
+		if stretch == 0 {
+			return &v
+		}
+		return newStretchVoice(v, float64(p.sample.rate)/float64(sr)/stretch)
+	}
+	// hits are at the root, moved by ratchet pitch ramps
+	renderNotes(buf, t.Triggers(triggerCode), func(n Note) Voice {
+		n.Key += p.root
+		return newVoice(n)
+	})
+	renderNotes(buf, t.Notes(p.root), newVoice)
+}
+
+type sampleVoice struct {
+	sample *Sample
+	pos    float64 // read position (frames)
+	rate   float64 // sample frames per output frame
+	gain   float64
+}
+
+func (v *sampleVoice) Next(gate bool) (l, r float64) {
+	l, r = v.sample.At(v.pos)
+	v.pos += v.rate
+	return l * v.gain, r * v.gain
+}
+
+func (v *sampleVoice) Done() bool {
+	return v.pos >= float64(v.sample.Frames())
+}
+
+func (v *sampleVoice) OneShot() {}
+
+// length of time-stretching grains (seconds)
+const stretchGrain = 0.05
+
+// stretchVoice plays a sample at a speed independent of its pitch by
+// overlapping windowed grains read at the pitch rate from positions
+// advancing at the stretched speed.
+type stretchVoice struct {
+	sampleVoice
+	advance float64    // sample frames per output frame
+	size    int        // grain length (frames)
+	starts  [2]float64 // sample positions of the active grains
+	frame   int        // output frames since the last grain started
+}
+
+func newStretchVoice(v sampleVoice, advance float64) *stretchVoice {
+	size := int(stretchGrain * float64(sr))
+	return &stretchVoice{
+		sampleVoice: v,
+		advance:     advance,
+		size:        size,
+		// start with a grain at full level reaching the start position
+		// so that the attack is kept
+		starts: [2]float64{0, v.pos - float64(size/2)*v.rate},
+	}
+}
+
+func (v *stretchVoice) Next(gate bool) (l, r float64) {
+	size := v.size
+	hop := size / 2
+	if v.frame%hop == 0 {
+		v.starts[0], v.starts[1] = v.starts[1], v.pos
+		v.frame = 0
+	}
+	for g, start := range v.starts {
+		// grain g started hop frames before the other one
+		j := float64(v.frame + (1-g)*hop)
+		w := math.Sin(math.Pi * j / float64(size))
+		gl, gr := v.sample.At(start + j*v.rate)
+		l += gl * w * w
+		r += gr * w * w
+	}
+	v.frame++
+	v.pos += v.advance
+	return l * v.gain, r * v.gain
+}
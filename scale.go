@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// intervals of scales (semitones above the tonic)
+var scaleIntervals = map[string][]float64{
+	"major":           {0, 2, 4, 5, 7, 9, 11},
+	"minor":           {0, 2, 3, 5, 7, 8, 10},
+	"harmonic":        {0, 2, 3, 5, 7, 8, 11},
+	"melodic":         {0, 2, 3, 5, 7, 9, 11},
+	"dorian":          {0, 2, 3, 5, 7, 9, 10},
+	"phrygian":        {0, 1, 3, 5, 7, 8, 10},
+	"lydian":          {0, 2, 4, 6, 7, 9, 11},
+	"mixolydian":      {0, 2, 4, 5, 7, 9, 10},
+	"locrian":         {0, 1, 3, 5, 6, 8, 10},
+	"pentatonic":      {0, 2, 4, 7, 9},
+	"minorpentatonic": {0, 3, 5, 7, 10},
+	"blues":           {0, 3, 5, 6, 7, 10},
+	"chromatic":       {0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+}
+
+// Scale is the key of a track, in which the digits of note lines are
+// scale degrees.
+type Scale struct {
+	tonic     float64 // pitch class (0 = C)
+	intervals []float64
+}
+
+// parseScale parses a key like "A minor" or "Eb" (major)
+func parseScale(s string) (*Scale, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("invalid key: %s", s)
+	}
+	key, err := parseNoteName(fields[0] + "4")
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %s", s)
+	}
+	name := "major"
+	if len(fields) == 2 {
+		name = strings.ToLower(fields[1])
+	}
+	intervals, ok := scaleIntervals[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown scale: %s", fields[1])
+	}
+	return &Scale{tonic: key - 60, intervals: intervals}, nil
+}
+
+// octave marks following a scale degree
+const (
+	octaveUp   = '\''
+	octaveDown = ','
+)
+
+// Key returns the key of a degree token like 5, 3' or 1,, in the octave
+// starting with the first tonic at or above base: degrees from 1 count
+// up the scale into the next octaves, each ' raises the note by an
+// octave and each , lowers it.
+func (s *Scale) Key(token string, base float64) (float64, bool) {
+	if token[0] < '1' || token[0] > '9' {
+		return 0, false
+	}
+	degree := int(token[0] - '1')
+	n := len(s.intervals)
+	key := base + math.Mod(math.Mod(s.tonic-base, 12)+12, 12)
+	key += s.intervals[degree%n] + float64(12*(degree/n))
+	for _, mark := range token[1:] {
+		switch mark {
+		case octaveUp:
+			key += 12
+		case octaveDown:
+			key -= 12
+		}
+	}
+	return key, true
+}
+
+// noteTokens splits a note line into steps; in a key, octave marks are
+// part of the step of the degree before them
+func (t *Track) noteTokens(data string) []string {
+	tokens := stepTokens(data)
+	if t.scale == nil {
+		return tokens
+	}
+	var merged []string
+	for _, token := range tokens {
+		if (token[0] == octaveUp || token[0] == octaveDown) && len(merged) > 0 {
+			merged[len(merged)-1] += token
+			continue
+		}
+		merged = append(merged, token)
+	}
+	return merged
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+type sfzRegion struct {
+	sample    *Sample
+	lokey     float64
+	hikey     float64
+	keycenter float64
+	lovel     float64
+	hivel     float64
+	tune      float64 // semitones
+	volume    float64 // linear gain
+	offset    int     // start frame
+	loopMode  string
+	loopStart int
+	loopEnd   int
+	adsr      ADSR
+}
+
+var (
+	sfzCommentPattern = regexp.MustCompile(`//.*`)
+	sfzHeaderPattern  = regexp.MustCompile(`<(\w+)>`)
+	sfzOpcodePattern  = regexp.MustCompile(`(\w+)=`)
+)
+
+// parseSfzOpcodes splits the opcodes of a header body; values may
+// contain spaces and run until the next opcode.
+func parseSfzOpcodes(body string) map[string]string {
+	opcodes := make(map[string]string)
+	locs := sfzOpcodePattern.FindAllStringSubmatchIndex(body, -1)
+	for i, loc := range locs {
+		end := len(body)
+		if i+1 < len(locs) {
+			end = locs[i+1][0]
+		}
+		opcodes[body[loc[2]:loc[3]]] = strings.TrimSpace(body[loc[1]:end])
+	}
+	return opcodes
+}
+
+func loadSfz(filename string) ([]*sfzRegion, error) {
+	path := songPath(filename)
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	src := sfzCommentPattern.ReplaceAllString(string(text), "")
+	dir := filepath.Dir(path)
+	var regions []*sfzRegion
+	global := map[string]string{}
+	group := map[string]string{}
+	headers := sfzHeaderPattern.FindAllStringSubmatchIndex(src, -1)
+	for i, loc := range headers {
+		end := len(src)
+		if i+1 < len(headers) {
+			end = headers[i+1][0]
+		}
+		opcodes := parseSfzOpcodes(src[loc[1]:end])
+		switch header := src[loc[2]:loc[3]]; header {
+		case "control":
+			if p, ok := opcodes["default_path"]; ok {
+				dir = filepath.Join(dir, p)
+			}
+		case "global":
+			global = opcodes
+			group = map[string]string{}
+		case "group", "master":
+			group = opcodes
+		case "region":
+			merged := make(map[string]string)
+			for _, m := range []map[string]string{global, group, opcodes} {
+				for k, v := range m {
+					merged[k] = v
+				}
+			}
+			r, err := newSfzRegion(dir, merged)
+			if err != nil {
+				return nil, fmt.Errorf("%s: region %d: %w", filename, len(regions)+1, err)
+			}
+			regions = append(regions, r)
+		}
+	}
+	return regions, nil
+}
+
+func newSfzRegion(dir string, opcodes map[string]string) (*sfzRegion, error) {
+	var err error
+	value := func(name string, def float64) float64 {
+		s, ok := opcodes[name]
+		if !ok || err != nil {
+			return def
+		}
+		var v float64
+		if v, err = parseKey(s); err != nil {
+			err = fmt.Errorf("invalid %s value: %s", name, s)
+		}
+		return v
+	}
+	name, ok := opcodes["sample"]
+	if !ok {
+		return nil, fmt.Errorf("missing sample opcode")
+	}
+	sample, err := loadSample(filepath.Join(dir, filepath.FromSlash(strings.ReplaceAll(name, `\`, "/"))))
+	if err != nil {
+		return nil, err
+	}
+	key := value("key", -1)
+	r := &sfzRegion{
+		sample:    sample,
+		lokey:     value("lokey", 0),
+		hikey:     value("hikey", 127),
+		keycenter: value("pitch_keycenter", 60),
+		lovel:     value("lovel", 1),
+		hivel:     value("hivel", 127),
+		tune:      value("transpose", 0) + value("tune", 0)/100,
+		volume:    math.Pow(10, value("volume", 0)/20),
+		offset:    int(value("offset", 0)),
+		loopMode:  opcodes["loop_mode"],
+		loopStart: int(value("loop_start", 0)),
+		loopEnd:   int(value("loop_end", float64(sample.Frames()-1))),
+		adsr: ADSR{
+			Attack:  value("ampeg_attack", 0),
+			Decay:   value("ampeg_decay", 0),
+			Sustain: value("ampeg_sustain", 100) / 100,
+			Release: value("ampeg_release", 0.001),
+		},
+	}
+	if key >= 0 {
+		r.lokey, r.hikey, r.keycenter = key, key, key
+		if _, ok := opcodes["pitch_keycenter"]; ok {
+			r.keycenter = value("pitch_keycenter", key)
+		}
+	}
+	if r.loopMode == "" {
+		r.loopMode = "no_loop"
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.loopEnd <= r.loopStart || r.loopEnd >= sample.Frames() {
+		r.loopMode = "no_loop"
+	}
+	return r, nil
+}
+
+type SfzInstrument struct {
+	regions []*sfzRegion
+	note    float64 // key of the first note character
+	gain    float64
+}
+
+func sfzFactory(args string) (Processor, error) {
+	a := parseArgs(args, "path", "note", "gain")
+	path := a.String("path", "")
+	if path == "" {
+		return nil, fmt.Errorf("missing SFZ path")
+	}
+	s := &SfzInstrument{
+		note: a.Key("note", 60),
+		gain: a.Float("gain", 1),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	regions, err := loadSfz(path)
+	if err != nil {
+		return nil, err
+	}
+	s.regions = regions
+	return s, nil
+}
+
+func (s *SfzInstrument) Process(t *Track, buf SampleBuffer) {
+	for _, n := range t.Notes(s.note) {
+		// accents and humanization can take velocities past the MIDI range
+		vel := min(max(math.Round(n.Velocity*127), 1), 127)
+		for _, r := range s.regions {
+			if n.Key < r.lokey || n.Key > r.hikey || vel < r.lovel || vel > r.hivel {
+				continue
+			}
+			renderNotes(buf, []Note{n}, func(n Note) Voice {
+				return &sfzVoice{
+					region: r,
+					pos:    float64(r.offset),
+					rate:   keyRatio(n.Key, r.keycenter) * math.Pow(2, r.tune/12) * float64(r.sample.rate) / float64(sr),
+					env:    NewEnvelope(r.adsr),
+					gain:   s.gain * r.volume * n.Velocity,
+				}
+			})
+		}
+	}
+}
+
+type sfzVoice struct {
+	region *sfzRegion
+	pos    float64
+	rate   float64
+	env    *Envelope
+	gain   float64
+}
+
+func (v *sfzVoice) Next(gate bool) (l, r float64) {
+	region := v.region
+	l, r = region.sample.At(v.pos)
+	amp := v.gain
+	if region.loopMode == "one_shot" {
+		amp *= v.env.Next(true)
+	} else {
+		amp *= v.env.Next(gate)
+	}
+	v.pos += v.rate
+	loop := region.loopMode == "loop_continuous" || region.loopMode == "loop_sustain" && gate
+	if loop && v.pos > float64(region.loopEnd) {
+		v.pos -= float64(region.loopEnd - region.loopStart + 1)
+	}
+	return l * amp, r * amp
+}
+
+func (v *sfzVoice) Done() bool {
+	return v.env.Done() || v.pos >= float64(v.region.sample.Frames())
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Shimmer is a reverb whose tail is pitch shifted and fed back into its
+// input, so that it keeps rising in octaves as it decays.
+type Shimmer struct {
+	decay    float64 // room size (0..1)
+	damp     float64 // high frequency damping (0..1)
+	ratio    float64 // pitch ratio of the feedback
+	amount   float64 // shifted signal fed back (0..1)
+	mix      float64 // dry/wet (0..1)
+	verbs    [2]*Freeverb
+	shifters [2]*PitchShifter
+	last     [2]float64
+}
+
+func shimmerFactory(args string) (Processor, error) {
+	a := parseArgs(args, "decay", "shift", "amount", "damp", "mix")
+	s := &Shimmer{
+		decay:  a.Float("decay", 0.8),
+		ratio:  math.Pow(2, clampShift(a.Float("shift", 12))/12),
+		amount: a.Float("amount", 0.5),
+		damp:   a.Float("damp", 0.3),
+		mix:    a.Float("mix", 0.4),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	if s.decay < 0 || s.decay > 1 {
+		return nil, fmt.Errorf("invalid decay value: %g", s.decay)
+	}
+	if s.damp < 0 || s.damp > 1 {
+		return nil, fmt.Errorf("invalid damp value: %g", s.damp)
+	}
+	for c := range s.verbs {
+		s.verbs[c] = NewFreeverb(s.decay, s.damp, c*reverbStereoSpread)
+		s.shifters[c] = NewPitchShifter(0.1 * float64(sr))
+	}
+	return s, nil
+}
+
+func (s *Shimmer) Process(t *Track, buf SampleBuffer) {
+	// same input gain as Reverb
+	const inputGain = 0.015
+	for i := 0; i < len(buf); i += nchannels {
+		in := (buf[i] + buf[i+1]) / 2
+		for c := range s.verbs {
+			// saturate the loop so it can't run away
+			fb := math.Tanh(s.shifters[c].Process(s.last[c], s.ratio) * s.amount)
+			s.last[c] = s.verbs[c].Process((in + fb) * inputGain)
+			buf[i+c] = buf[i+c]*(1-s.mix) + s.last[c]*s.mix
+		}
+	}
+}
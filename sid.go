@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// data line codes of the SID voices
+const sidCodes = "123"
+
+// SID waveform bits
+const (
+	sidTriangle = 1 << iota
+	sidSaw
+	sidPulse
+	sidNoise
+)
+
+var sidWaveforms = map[string]int{
+	"tri":   sidTriangle,
+	"saw":   sidSaw,
+	"pulse": sidPulse,
+	"noise": sidNoise,
+}
+
+// parseSidWaveform parses a combination of waveforms like "saw+pulse"
+func parseSidWaveform(s string) (int, error) {
+	wave := 0
+	for _, name := range strings.Split(s, "+") {
+		bit, ok := sidWaveforms[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown SID waveform: %s", name)
+		}
+		wave |= bit
+	}
+	return wave, nil
+}
+
+type sidVoiceConfig struct {
+	wave   int
+	pw     float64 // pulse width (0..1)
+	ring   bool    // ring modulate triangle by the previous voice
+	sync   bool    // hard sync to the previous voice
+	filter bool    // route through the filter
+}
+
+// SID models the three voices of the C64 sound chip. Each voice plays
+// the notes of its own data line ('1', '2', '3'); voice 1 is modulated
+// by voice 3, voice 2 by voice 1 and voice 3 by voice 2.
+type SID struct {
+	voices [3]sidVoiceConfig
+	note   float64 // key of the first note character
+	adsr   ADSR
+	mode   FilterMode
+	cutoff float64
+	res    float64
+	drive  float64 // filter distortion
+	gain   float64
+}
+
+func sidFactory(args string) (Processor, error) {
+	a := parseArgs(args, "wave1", "wave2", "wave3", "note",
+		"pw1", "pw2", "pw3", "ring", "sync", "filter",
+		"mode", "cutoff", "res", "drive",
+		"attack", "decay", "sustain", "release", "gain")
+	mode, err := parseFilterMode(a.String("mode", "lp"))
+	if err != nil {
+		return nil, err
+	}
+	s := &SID{
+		note:   a.Key("note", 48),
+		mode:   mode,
+		cutoff: a.Float("cutoff", 2000),
+		res:    a.Float("res", 0.3),
+		drive:  a.Float("drive", 1.5),
+		adsr: ADSR{
+			Attack:  a.Float("attack", 0.002),
+			Decay:   a.Float("decay", 0.1),
+			Sustain: a.Float("sustain", 0.7),
+			Release: a.Float("release", 0.1),
+		},
+		gain: a.Float("gain", 1),
+	}
+	// ring, sync and filter take the numbers of the voices they apply to
+	ring := a.String("ring", "")
+	sync := a.String("sync", "")
+	filter := a.String("filter", "123")
+	waves := [3]string{a.String("wave1", "pulse"), a.String("wave2", "saw"), a.String("wave3", "tri")}
+	pws := [3]float64{a.Float("pw1", 0.5), a.Float("pw2", 0.5), a.Float("pw3", 0.5)}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	for i := range s.voices {
+		wave, err := parseSidWaveform(waves[i])
+		if err != nil {
+			return nil, err
+		}
+		s.voices[i] = sidVoiceConfig{
+			wave:   wave,
+			pw:     pws[i],
+			ring:   strings.IndexByte(ring, sidCodes[i]) != -1,
+			sync:   strings.IndexByte(sync, sidCodes[i]) != -1,
+			filter: strings.IndexByte(filter, sidCodes[i]) != -1,
+		}
+	}
+	return s, nil
+}
+
+// sidOsc is a 24-bit phase accumulator with SID style waveform output
+type sidOsc struct {
+	acc     uint32
+	prevAcc uint32
+	lfsr    uint32
+	freq    float64
+	gate    bool
+	env     *Envelope
+	wrapped bool // accumulator overflowed in the last step
+}
+
+func (o *sidOsc) step() {
+	inc := uint32(o.freq * (1 << 24) / float64(sr))
+	o.prevAcc = o.acc
+	o.acc = (o.acc + inc) & 0xffffff
+	o.wrapped = o.acc < o.prevAcc
+	// the noise LFSR is clocked by bit 19 of the accumulator
+	if o.acc&0x80000 != 0 && o.prevAcc&0x80000 == 0 {
+		bit := (o.lfsr>>22 ^ o.lfsr>>17) & 1
+		o.lfsr = (o.lfsr<<1 | bit) & 0x7fffff
+	}
+}
+
+// output returns the 12-bit waveform output, combined waveforms are
+// ANDed like on the real chip
+func (o *sidOsc) output(cfg sidVoiceConfig, mod *sidOsc) uint32 {
+	out := uint32(0xfff)
+	if cfg.wave&sidTriangle != 0 {
+		msb := o.acc & 0x800000
+		if cfg.ring {
+			msb ^= mod.acc & 0x800000
+		}
+		tri := o.acc
+		if msb != 0 {
+			tri = ^tri
+		}
+		out &= tri >> 11 & 0xfff
+	}
+	if cfg.wave&sidSaw != 0 {
+		out &= o.acc >> 12
+	}
+	if cfg.wave&sidPulse != 0 {
+		if float64(o.acc>>12) < cfg.pw*4096 {
+			out = 0
+		}
+	}
+	if cfg.wave&sidNoise != 0 {
+		l := o.lfsr
+		noise := (l>>22&1)<<11 | (l>>20&1)<<10 | (l>>16&1)<<9 | (l>>13&1)<<8 |
+			(l>>11&1)<<7 | (l>>7&1)<<6 | (l>>4&1)<<5 | (l>>2&1)<<4
+		out &= noise
+	}
+	return out
+}
+
+func (s *SID) Process(t *Track, buf SampleBuffer) {
+	frames := len(buf) / nchannels
+	var oscs [3]sidOsc
+	var starts [3]map[int]Note
+	for i := range oscs {
+		oscs[i].lfsr = 0x7ffff8
+		oscs[i].env = NewEnvelope(s.adsr)
+		starts[i] = make(map[int]Note)
+		for _, n := range t.NoteLine(rune(sidCodes[i]), s.note) {
+			starts[i][n.Start] = n
+		}
+	}
+	var ends [3]int
+	var filter SVF
+	for f := 0; f < frames; f++ {
+		for i := range oscs {
+			o := &oscs[i]
+			if n, ok := starts[i][f]; ok {
+				o.freq = noteFreq(n.Key)
+				ends[i] = n.Start + n.Length
+				o.env.Retrigger()
+			}
+			o.gate = f < ends[i]
+		}
+		for i := range oscs {
+			oscs[i].step()
+		}
+		for i := range oscs {
+			if s.voices[i].sync && oscs[(i+2)%3].wrapped {
+				oscs[i].acc = 0
+			}
+		}
+		var filtered, direct float64
+		for i := range oscs {
+			o := &oscs[i]
+			wave := float64(o.output(s.voices[i], &oscs[(i+2)%3]))/2048 - 1
+			if s.voices[i].wave == 0 {
+				wave = 0
+			}
+			out := wave * o.env.Next(o.gate)
+			if s.voices[i].filter {
+				filtered += out
+			} else {
+				direct += out
+			}
+		}
+		if s.drive > 0 {
+			filtered = math.Tanh(filtered*s.drive) / s.drive
+		}
+		filtered = filter.Filter(filtered, s.cutoff, s.res, s.mode)
+		out := (filtered + direct) / 3 * s.gain
+		buf[f*nchannels] += out
+		buf[f*nchannels+1] += out
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Line is a line of a song file with comments removed.
+type Line struct {
+	file string // file the line comes from
+	num  int    // line number in file
+	text string
+}
+
+var (
+	// comments start with # or ;, trailing ones after whitespace
+	commentLinePattern     = regexp.MustCompile(`^\s*[#;]`)
+	trailingCommentPattern = regexp.MustCompile(`\s+[#;].*$`)
+	includePattern         = regexp.MustCompile(`^include\s+(.+)$`)
+	// data lines with steps separated by whitespace
+	spacedLinePattern = regexp.MustCompile(`^.\s*=`)
+)
+
+// readLines returns the lines of a song file, replacing include
+// directives with the lines of the included file. Included paths are
+// relative to the including file. A line ending in a backslash
+// continues on the next one, without the whitespace around the break,
+// which becomes a single space in data lines of whitespace-separated steps.
+func readLines(filename string) ([]Line, error) {
+	return readIncludedLines(filename, nil)
+}
+
+func readIncludedLines(filename string, including []string) ([]Line, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(including, abs) {
+		return nil, fmt.Errorf("recursive include of %s", filename)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []Line
+	scanner := bufio.NewScanner(f)
+	num := 0
+	continued := false // whether the last line ends in a backslash
+	for scanner.Scan() {
+		num++
+		text := scanner.Text()
+		if commentLinePattern.MatchString(text) {
+			continue
+		}
+		text = trailingCommentPattern.ReplaceAllString(text, "")
+		if continued {
+			last := &lines[len(lines)-1]
+			sep := ""
+			if spacedLinePattern.MatchString(last.text) {
+				sep = " "
+			}
+			last.text, continued = continueLine(last.text + sep + strings.TrimLeft(text, " \t"))
+			continue
+		}
+		if matches := includePattern.FindStringSubmatch(text); matches != nil {
+			path := matches[1]
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(filepath.Dir(filename), path)
+			}
+			included, err := readIncludedLines(path, append(including, abs))
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: cannot include %s: %w", filename, num, matches[1], err)
+			}
+			lines = append(lines, included...)
+			continue
+		}
+		text, continued = continueLine(text)
+		lines = append(lines, Line{file: filename, num: num, text: text})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// continueLine removes the backslash continuing a line and the
+// whitespace before it
+func continueLine(text string) (string, bool) {
+	trimmed := strings.TrimRight(text, " \t")
+	if !strings.HasSuffix(trimmed, "\\") {
+		return text, false
+	}
+	return strings.TrimRight(strings.TrimSuffix(trimmed, "\\"), " \t"), true
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadLinesContinuation(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "song.tt")
+	song := "n= C4 D4 \\\n   E4 F4\nv x...\\\n  x...\n"
+	if err := os.WriteFile(filename, []byte(song), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lines, err := readLines(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"n= C4 D4 E4 F4", "v x...x..."}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d", len(lines), len(want))
+	}
+	for i, line := range lines {
+		if line.text != want[i] {
+			t.Errorf("line %d: got %q, want %q", i+1, line.text, want[i])
+		}
+	}
+}
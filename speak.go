@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// phoneme is a crude approximation of the sound of a letter
+type phoneme struct {
+	formants [3]formant
+	voiced   float64 // level of the pulse source
+	noise    float64 // level of the noise source
+	length   float64 // seconds
+}
+
+var (
+	nasalFormants     = [3]formant{{250, 0.5, 60}, {1400, 0.1, 100}, {2400, 0.05, 100}}
+	liquidFormants    = [3]formant{{380, 1, 60}, {1300, 0.35, 90}, {2200, 0.15, 100}}
+	fricativeFormants = [3]formant{{2500, 0.4, 1000}, {4500, 1, 1500}, {6500, 0.5, 2000}}
+	plosiveFormants   = [3]formant{{500, 0.5, 300}, {1800, 1, 800}, {3500, 0.5, 1200}}
+)
+
+func letterPhoneme(c rune) (phoneme, bool) {
+	switch c {
+	case 'a', 'e', 'i', 'o', 'u':
+		return phoneme{vowelFormants[byte(c)], 1, 0, 0.14}, true
+	case 'y':
+		return phoneme{vowelFormants['i'], 1, 0, 0.1}, true
+	case 'w':
+		return phoneme{vowelFormants['u'], 1, 0, 0.07}, true
+	case 'm', 'n':
+		return phoneme{nasalFormants, 0.8, 0, 0.08}, true
+	case 'l', 'r':
+		return phoneme{liquidFormants, 0.9, 0, 0.07}, true
+	case 's', 'f', 'h', 'c', 'x':
+		return phoneme{fricativeFormants, 0, 1, 0.09}, true
+	case 'z', 'v', 'j':
+		return phoneme{fricativeFormants, 0.4, 0.8, 0.08}, true
+	case 'p', 't', 'k', 'q':
+		return phoneme{plosiveFormants, 0, 1, 0.04}, true
+	case 'b', 'd', 'g':
+		return phoneme{plosiveFormants, 0.5, 0.6, 0.04}, true
+	}
+	return phoneme{}, false
+}
+
+// SpeakSynth renders the words of a text one after the other, one word
+// for each note of the note line.
+type SpeakSynth struct {
+	words [][]phoneme
+	note  float64 // key of the first note character
+	gain  float64
+	next  int // index of the word spoken by the next note
+}
+
+func speakSynthFactory(args string) (Processor, error) {
+	a := parseArgs(args, "text", "note", "gain")
+	text := a.String("text", "")
+	s := &SpeakSynth{
+		note: a.Key("note", 48),
+		gain: a.Float("gain", 0.5),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		var phonemes []phoneme
+		for _, c := range word {
+			if p, ok := letterPhoneme(c); ok {
+				phonemes = append(phonemes, p)
+			} else if unicode.IsLetter(c) {
+				return nil, fmt.Errorf("cannot speak letter: %c", c)
+			}
+		}
+		if len(phonemes) > 0 {
+			s.words = append(s.words, phonemes)
+		}
+	}
+	if len(s.words) == 0 {
+		return nil, fmt.Errorf("nothing to speak")
+	}
+	return s, nil
+}
+
+func (s *SpeakSynth) Process(t *Track, buf SampleBuffer) {
+	renderNotes(buf, t.Notes(s.note), func(n Note) Voice {
+		word := s.words[s.next%len(s.words)]
+		s.next++
+		return &speakVoice{
+			phonemes: word,
+			osc:      Oscillator{wave: Pulse, width: 0.2},
+			freq:     noteFreq(n.Key),
+			gain:     s.gain * n.Velocity,
+		}
+	})
+}
+
+type speakVoice struct {
+	phonemes []phoneme
+	current  int // index of the current phoneme
+	age      int // frames into the current phoneme
+	osc      Oscillator
+	noise    Noise
+	filters  [3]SVF
+	freq     float64
+	gain     float64
+}
+
+func (v *speakVoice) Next(gate bool) (l, r float64) {
+	p := v.phonemes[v.current]
+	length := int(p.length * float64(sr))
+	// glide towards the next phoneme during the second half
+	f := p.formants
+	if v.current+1 < len(v.phonemes) && v.age > length/2 {
+		frac := float64(v.age-length/2) / float64(length-length/2)
+		next := v.phonemes[v.current+1].formants
+		for k := range f {
+			f[k].freq += (next[k].freq - f[k].freq) * frac
+			f[k].gain += (next[k].gain - f[k].gain) * frac
+			f[k].bw += (next[k].bw - f[k].bw) * frac
+		}
+	}
+	in := v.osc.Next(v.freq)*p.voiced + v.noise.Next()*p.noise*0.3
+	out := 0.0
+	for k := range f {
+		_, bp, _ := v.filters[k].Process(in, f[k].freq, qToRes(f[k].freq/f[k].bw))
+		out += bp * f[k].gain * f[k].bw / f[k].freq
+	}
+	// fade in and out at the edges of the word
+	edge := int(0.01 * float64(sr))
+	amp := 1.0
+	if v.current == 0 && v.age < edge {
+		amp = float64(v.age) / float64(edge)
+	} else if v.current == len(v.phonemes)-1 && length-v.age < edge {
+		amp = float64(length-v.age) / float64(edge)
+	}
+	v.age++
+	if v.age >= length {
+		v.age = 0
+		v.current++
+	}
+	out *= amp * v.gain
+	return out, out
+}
+
+func (v *speakVoice) Done() bool {
+	return v.current >= len(v.phonemes)
+}
+
+func (v *speakVoice) OneShot() {}
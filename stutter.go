@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math"
+	"slices"
+)
+
+// length of the fades at the edges of stutter slices (seconds)
+const stutterFade = 0.002
+
+// Stutter captures slices of the pattern buffer at the steps marked in
+// the trigger line and repeats them. Step characters:
+//
+//	x    repeat a slice of the given size starting at the step
+//	1-9  repeat a slice of size/N
+//	r    repeat the slice reversed
+//	u, d repeat the slice an octave up or down
+//	-    keep repeating the current slice
+//
+// Any other character lets the input pass through.
+type Stutter struct {
+	size Duration // slice length
+	gain float64
+}
+
+func stutterFactory(args string) (Processor, error) {
+	a := parseArgs(args, "size", "gain")
+	s := &Stutter{
+		size: a.Duration("size", "1"),
+		gain: a.Float("gain", 1),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Stutter) Process(t *Track, buf SampleBuffer) {
+	dry := slices.Clone(buf)
+	frames := len(buf) / nchannels
+	fade := stutterFade * float64(sr)
+	var start, length int // captured slice
+	var rate float64      // 0 = pass through
+	var reverse bool
+	for i := 0; i < t.steps; i++ {
+		c := t.StepData(triggerCode, i)
+		switch {
+		case c == '-':
+		case c == 'x' || c == 'r' || c == 'u' || c == 'd' || c >= '1' && c <= '9':
+			start = t.StepStart(i)
+			length = int(s.size.Frames(t))
+			if c >= '1' && c <= '9' {
+				length /= int(c - '0')
+			}
+			length = min(max(length, 1), frames-start)
+			rate = 1
+			switch c {
+			case 'u':
+				rate = 2
+			case 'd':
+				rate = 0.5
+			}
+			reverse = c == 'r'
+		default:
+			rate = 0
+		}
+		if rate == 0 || length <= 0 {
+			continue
+		}
+		end := min(t.StepStart(i+1), frames)
+		if i == t.steps-1 {
+			end = frames
+		}
+		for f := t.StepStart(i); f < end; f++ {
+			pos := math.Mod(float64(f-start)*rate, float64(length))
+			if reverse {
+				pos = float64(length) - 1 - pos
+			}
+			env := min(1, pos/fade, (float64(length)-pos)/fade)
+			j := start + int(pos)
+			buf[f*nchannels] = dry[j*nchannels] * env * s.gain
+			buf[f*nchannels+1] = dry[j*nchannels+1] * env * s.gain
+		}
+	}
+}
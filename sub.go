@@ -0,0 +1,120 @@
+package main
+
+import (
+	"math"
+)
+
+// SubSynth is a subtractive voice: oscillator into a resonant low-pass
+// filter, with separate envelopes for amplitude and cutoff.
+type SubSynth struct {
+	wave   Waveform
+	unison Unison
+	note   float64 // key of the first note character
+	cutoff float64 // Hz
+	res    float64 // 0..1
+	envamt float64 // cutoff modulation by the filter envelope (octaves)
+	velamt float64 // cutoff reduction at zero velocity (octaves)
+	accent float64 // cutoff boost of accented notes (octaves)
+	adsr   ADSR
+	fadsr  ADSR
+	gain   float64
+}
+
+func subSynthFactory(args string) (Processor, error) {
+	a := parseArgs(args, "wave", "note", "cutoff", "res", "envamt",
+		"attack", "decay", "sustain", "release",
+		"fattack", "fdecay", "fsustain", "frelease", "gain", "velamt", "accent",
+		"unison", "spread", "width")
+	wave, err := parseWaveform(a.String("wave", "saw"))
+	if err != nil {
+		return nil, err
+	}
+	s := &SubSynth{
+		wave:   wave,
+		unison: parseUnison(a),
+		note:   a.Key("note", 48),
+		cutoff: a.Float("cutoff", 800),
+		res:    a.Float("res", 0.3),
+		envamt: a.Float("envamt", 3),
+		velamt: a.Float("velamt", 0),
+		accent: a.Float("accent", 1),
+		adsr: ADSR{
+			Attack:  a.Float("attack", 0.005),
+			Decay:   a.Float("decay", 0.2),
+			Sustain: a.Float("sustain", 0.7),
+			Release: a.Float("release", 0.1),
+		},
+		fadsr: ADSR{
+			Attack:  a.Float("fattack", 0.005),
+			Decay:   a.Float("fdecay", 0.2),
+			Sustain: a.Float("fsustain", 0),
+			Release: a.Float("frelease", 0.1),
+		},
+		gain: a.Float("gain", 0.3),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SubSynth) Process(t *Track, buf SampleBuffer) {
+	cutoff := t.Param("cutoff", s.cutoff, 20, 20000)
+	res := t.Param("res", s.res, 0, 1)
+	bend := t.Param("bend", 0, -2, 2)
+	decay := t.Param("decay", s.adsr.Decay, 0.01, 2)
+	renderNotes(buf, t.Notes(s.note), func(n Note) Voice {
+		adsr := s.adsr
+		adsr.Decay = decay.Step(n.Step)
+		boost := 0.0
+		if n.Accent {
+			boost = s.accent
+		}
+		return &subVoice{
+			synth:  s,
+			cutoff: cutoff,
+			res:    res,
+			bend:   bend,
+			frame:  n.Start,
+			osc:    NewUnisonOscillator(s.wave, s.unison),
+			freq:   noteFreq(n.Key),
+			vel:    min(n.Velocity, 1),
+			boost:  boost,
+			env:    NewEnvelope(adsr),
+			fenv:   NewEnvelope(s.fadsr),
+			gain:   s.gain * n.Velocity,
+		}
+	})
+}
+
+type subVoice struct {
+	synth   *SubSynth
+	osc     *UnisonOscillator
+	filterL SVF
+	filterR SVF
+	cutoff  *Param
+	res     *Param
+	bend    *Param // semitones
+	frame   int    // track frame of the next sample
+	freq    float64
+	vel     float64
+	boost   float64 // cutoff offset (octaves)
+	env     *Envelope
+	fenv    *Envelope
+	gain    float64
+}
+
+func (v *subVoice) Next(gate bool) (l, r float64) {
+	cutoff := v.cutoff.At(v.frame) * math.Pow(2, v.synth.envamt*v.fenv.Next(gate)-v.synth.velamt*(1-v.vel)+v.boost)
+	res := v.res.At(v.frame)
+	l, r = v.osc.Next(v.freq * math.Pow(2, v.bend.At(v.frame)/12))
+	l, _, _ = v.filterL.Process(l, cutoff, res)
+	r, _, _ = v.filterR.Process(r, cutoff, res)
+	v.frame++
+	amp := v.env.Next(gate) * v.gain
+	return l * amp, r * amp
+}
+
+func (v *subVoice) Done() bool {
+	return v.env.Done()
+}
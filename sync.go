@@ -0,0 +1,97 @@
+package main
+
+import (
+	"math"
+)
+
+// data line code holding per-step sync sweep amounts
+const sweepCode = 's'
+
+// SyncSynth is a slave oscillator hard-synced to a master running at
+// the note frequency. The slave's pitch sweeps from ratio semitones
+// above the master by sweep semitones over time seconds; hex digits in
+// the sweep line override the sweep per note (2 semitones per unit).
+type SyncSynth struct {
+	wave  Waveform
+	note  float64 // key of the first note character
+	ratio float64 // initial slave pitch above the master (semitones)
+	sweep float64 // slave pitch change over the sweep (semitones)
+	time  float64 // sweep time (seconds)
+	adsr  ADSR
+	gain  float64
+}
+
+func syncSynthFactory(args string) (Processor, error) {
+	a := parseArgs(args, "wave", "note", "ratio", "sweep", "time", "attack", "decay", "sustain", "release", "gain")
+	wave, err := parseWaveform(a.String("wave", "saw"))
+	if err != nil {
+		return nil, err
+	}
+	s := &SyncSynth{
+		wave:  wave,
+		note:  a.Key("note", 48),
+		ratio: a.Float("ratio", 7),
+		sweep: a.Float("sweep", 24),
+		time:  a.Float("time", 0.3),
+		adsr: ADSR{
+			Attack:  a.Float("attack", 0.005),
+			Decay:   a.Float("decay", 0.1),
+			Sustain: a.Float("sustain", 0.7),
+			Release: a.Float("release", 0.1),
+		},
+		gain: a.Float("gain", 0.3),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SyncSynth) Process(t *Track, buf SampleBuffer) {
+	renderNotes(buf, t.Notes(s.note), func(n Note) Voice {
+		sweep := s.sweep
+		if d := hexDigit(t.StepData(sweepCode, n.Step)); d != -1 {
+			sweep = float64(2 * d)
+		}
+		return &syncVoice{
+			synth: s,
+			slave: Oscillator{wave: s.wave},
+			freq:  noteFreq(n.Key),
+			sweep: sweep,
+			env:   NewEnvelope(s.adsr),
+			gain:  s.gain * n.Velocity,
+		}
+	})
+}
+
+type syncVoice struct {
+	synth  *SyncSynth
+	master float64 // master phase
+	slave  Oscillator
+	freq   float64
+	sweep  float64 // semitones
+	age    int
+	env    *Envelope
+	gain   float64
+}
+
+func (v *syncVoice) Next(gate bool) (l, r float64) {
+	progress := 1.0
+	if v.synth.time > 0 {
+		progress = min(float64(v.age)/(v.synth.time*float64(sr)), 1)
+	}
+	v.age++
+	ratio := math.Pow(2, (v.synth.ratio+v.sweep*progress)/12)
+	out := v.slave.Next(v.freq*ratio) * v.env.Next(gate) * v.gain
+	v.master += v.freq / float64(sr)
+	if v.master >= 1 {
+		v.master -= math.Floor(v.master)
+		v.slave.phase = v.master * ratio
+		v.slave.phase -= math.Floor(v.slave.phase)
+	}
+	return out, out
+}
+
+func (v *syncVoice) Done() bool {
+	return v.env.Done()
+}
@@ -0,0 +1,749 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// data line code holding the notes of melodic tracks
+const noteCode = 'n'
+
+// step characters of note data lines, each one a semitone above the
+// previous; any other character is a rest
+const noteChars = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+type Note struct {
+	Step     int     // step which triggered the note
+	Start    int     // first frame of the note
+	Length   int     // gate length in frames
+	Key      float64 // MIDI key number
+	Velocity float64 // 0..1
+	Accent   bool
+	Stop     int // frame at which a note-off releases the note, 0 = never
+}
+
+// cut releases the note at frame
+func (n *Note) cut(frame int) {
+	if n.Stop == 0 || frame < n.Stop {
+		n.Stop = frame
+	}
+}
+
+// noteFreq returns the frequency of a key in the tuning of the song
+func noteFreq(key float64) float64 {
+	if tuning != nil {
+		return tuning.Freq(key)
+	}
+	return 440 * math.Pow(2, (key-69)/12)
+}
+
+// keyRatio returns the frequency ratio between two keys
+func keyRatio(key, ref float64) float64 {
+	return noteFreq(key) / noteFreq(ref)
+}
+
+var noteNamePattern = regexp.MustCompile(`^([A-Ga-g])([#b]?)(-?[0-9])$`)
+
+var noteSemitones = map[byte]int{
+	'c': 0, 'd': 2, 'e': 4, 'f': 5, 'g': 7, 'a': 9, 'b': 11,
+}
+
+// parseNoteName returns the MIDI key of a note name like C4, A#3 or Eb2
+// (C4 = 60).
+func parseNoteName(s string) (float64, error) {
+	matches := noteNamePattern.FindStringSubmatch(s)
+	if matches == nil {
+		return 0, fmt.Errorf("invalid note name: %s", s)
+	}
+	key := noteSemitones[matches[1][0]|0x20]
+	switch matches[2] {
+	case "#":
+		key++
+	case "b":
+		key--
+	}
+	octave, _ := strconv.Atoi(matches[3])
+	return float64(key + 12*(octave+1)), nil
+}
+
+// Notes returns the notes triggered by the note data line of the track,
+// transposed by base.
+func (t *Track) Notes(base float64) []Note {
+	return t.NoteLine(noteCode, base)
+}
+
+// closing characters of step groups
+var stepGroups = map[byte]byte{'[': ']', '{': '}', '(': ')'}
+
+// stepTokens splits a data line into steps: a single character, a
+// group in brackets or braces like [C#4] or {Am} taking up one step, or
+// a tuplet in parentheses.
+func stepTokens(data string) []string {
+	var tokens []string
+	for i := 0; i < len(data); i++ {
+		if close := stepGroups[data[i]]; close != 0 {
+			if end := strings.IndexByte(data[i:], close); end != -1 {
+				tokens = append(tokens, data[i:i+end+1])
+				i += end
+				continue
+			}
+		}
+		_, size := utf8.DecodeRuneInString(data[i:])
+		tokens = append(tokens, data[i:i+size])
+		i += size - 1
+	}
+	return tokens
+}
+
+// isRest reports whether a step token is a rest: '.', ' ' or '·'
+func isRest(token string) bool {
+	return token == "." || token == " " || token == "·"
+}
+
+// spacedSteps converts the steps of a data line separated by whitespace,
+// like C#4 . E4 - (G4 A4 B4), to the usual form: steps longer than a
+// character become groups in brackets, unless they are groups, pattern
+// references, generators or the width of a tuplet like :2 already.
+func spacedSteps(data string) string {
+	var sb strings.Builder
+	for _, field := range strings.Fields(data) {
+		for strings.HasPrefix(field, "(") {
+			sb.WriteByte('(')
+			field = field[1:]
+		}
+		closing := len(field) - len(strings.TrimRight(field, ")"))
+		field = field[:len(field)-closing]
+		switch {
+		case field == "":
+		case utf8.RuneCountInString(field) == 1, stepGroups[field[0]] != 0, field[0] == '@', field[0] == ':', strings.Contains(field, "("):
+			sb.WriteString(field)
+		default:
+			sb.WriteString("[" + field + "]")
+		}
+		sb.WriteString(strings.Repeat(")", closing))
+	}
+	return sb.String()
+}
+
+// tuplet parses a tuplet token like (xxx) or (xxxxx:4): its steps are
+// played evenly in the time of width steps, by default the largest power
+// of two below their number, so that (xxx) is a triplet over two steps.
+func tuplet(token string, tokenize func(string) []string) (tokens []string, width int, ok bool) {
+	if token[0] != '(' || token[len(token)-1] != ')' {
+		return nil, 1, false
+	}
+	body := token[1 : len(token)-1]
+	width = 0
+	if i := strings.LastIndexByte(body, ':'); i != -1 {
+		if n, err := strconv.Atoi(body[i+1:]); err == nil && n > 0 {
+			body, width = body[:i], n
+		}
+	}
+	tokens = tokenize(body)
+	if width == 0 {
+		width = 1
+		for width*2 < len(tokens) {
+			width *= 2
+		}
+	}
+	return tokens, width, len(tokens) > 0
+}
+
+// stepWidth returns the number of steps taken up by a step token
+func stepWidth(token string, tokenize func(string) []string) int {
+	_, width, _ := tuplet(token, tokenize)
+	return width
+}
+
+// stepSlot is a step token placed in time
+type stepSlot struct {
+	token  string
+	step   int // step in which the slot starts
+	start  int // first frame
+	length int // frames
+}
+
+// stepSlots places the step tokens of a data line split by tokenize,
+// spreading the steps of tuplets over their width.
+func (t *Track) stepSlots(data string, tokenize func(string) []string) []stepSlot {
+	var slots []stepSlot
+	step := 0
+	for _, token := range tokenize(data) {
+		if step >= t.steps {
+			break
+		}
+		inner, width, ok := tuplet(token, tokenize)
+		if !ok {
+			slots = append(slots, stepSlot{token, step, t.StepStart(step), t.StepFrames(step)})
+			step++
+			continue
+		}
+		frames := t.gridStart(step+width) - t.gridStart(step)
+		for k, token := range inner {
+			offset := k * frames / len(inner)
+			slots = append(slots, stepSlot{
+				token:  token,
+				step:   step + k*width/len(inner),
+				start:  t.StepStart(step) + offset,
+				length: (k+1)*frames/len(inner) - offset,
+			})
+		}
+		step += width
+	}
+	return slots
+}
+
+// stepKeys returns the keys played by a step token of a note line:
+// note characters are transposed by base, or in a key scale degrees
+// are, while notes in brackets like [A#3] play at their key and chords
+// in braces like {Am7} are voiced above base.
+func stepKeys(token string, base float64, scale *Scale) []float64 {
+	if len(token) < 2 && (token[0] == '[' || token[0] == '{') {
+		return nil
+	}
+	switch token[0] {
+	case '[':
+		if key, err := parseNoteName(token[1 : len(token)-1]); err == nil {
+			return []float64{key}
+		}
+		return nil
+	case '{':
+		keys, _ := parseChord(token[1:len(token)-1], base)
+		return keys
+	}
+	if scale != nil {
+		if key, ok := scale.Key(token, base); ok {
+			return []float64{key}
+		}
+		return nil
+	}
+	if offset := strings.IndexByte(noteChars, token[0]); offset != -1 {
+		return []float64{base + float64(offset)}
+	}
+	return nil
+}
+
+// mapToken returns the token a single character of a note line is
+// mapped to: a note name like C3 is played at its key, while notes in
+// brackets and chords in braces are taken as written
+func (t *Track) mapToken(token string) string {
+	if utf8.RuneCountInString(token) != 1 {
+		return token
+	}
+	value, ok := t.charMap[token]
+	if !ok {
+		return token
+	}
+	if _, err := parseNoteName(value); err == nil {
+		return "[" + value + "]"
+	}
+	return value
+}
+
+// data line code holding per-step velocities
+const velocityCode = 'v'
+
+// StepVelocity returns the velocity (0..1) set for step i by the
+// velocity line: hex digits map 0..f to increasing velocities, other
+// characters or a missing line leave it at full. The groove scales it
+// further.
+func (t *Track) StepVelocity(i int) float64 {
+	v := 1.0
+	if d := hexDigit(t.StepData(velocityCode, i)); d != -1 {
+		v = float64(d) / 15
+	}
+	if t.groove != nil {
+		v *= t.groove.Velocity(t, i)
+	}
+	return v
+}
+
+// data line code marking accented steps
+const accentCode = 'a'
+
+// velocity gain of accented steps
+const accentGain = 1.4
+
+// StepAccent reports whether step i is marked in the accent line; any
+// step other than a rest is an accent.
+func (t *Track) StepAccent(i int) bool {
+	token := t.stepToken(accentCode, i)
+	return token != "" && !isRest(token)
+}
+
+// accent marks n as accented if its step is
+func (t *Track) accent(n Note) Note {
+	if t.StepAccent(n.Step) {
+		n.Accent = true
+		n.Velocity *= accentGain
+	}
+	return n
+}
+
+// data line code holding per-step trigger probabilities
+const probabilityCode = '?'
+
+// StepFires decides whether step i plays: its condition must hold, and
+// hex digits in the probability line give chances from 0 to 100%, drawn
+// anew each time the track is rendered; steps without a digit always
+// play.
+func (t *Track) StepFires(i int) bool {
+	if !t.StepCondition(i) {
+		return false
+	}
+	d := hexDigit(t.StepData(probabilityCode, i))
+	if d == -1 {
+		return true
+	}
+	return t.rng.Float64() < float64(d)/15
+}
+
+// data line code holding per-step trig conditions
+const conditionCode = '%'
+
+// StepCondition evaluates the condition of step i in the condition line
+// for the current play of the pattern: [A:B] plays on the Ath of every B
+// plays, [fill] only on the last play of a run of repeats and [!fill]
+// on the others. Steps without a condition always play.
+func (t *Track) StepCondition(i int) bool {
+	tokens := stepTokens(t.Data(conditionCode))
+	if i >= len(tokens) || tokens[i][0] != '[' {
+		return true
+	}
+	cond := tokens[i][1 : len(tokens[i])-1]
+	switch cond {
+	case "fill":
+		return t.fill
+	case "!fill":
+		return !t.fill
+	}
+	a, b, ok := strings.Cut(cond, ":")
+	n, err1 := strconv.Atoi(a)
+	m, err2 := strconv.Atoi(b)
+	if !ok || err1 != nil || err2 != nil || m < 1 {
+		return true
+	}
+	return t.play%m == n-1
+}
+
+// data line code holding per-step ratchets
+const ratchetCode = 'r'
+
+// Ratchet is the retriggering of a step: count notes divide its length
+// evenly, each one ramp times the velocity and pitch semitones above
+// the previous one.
+type Ratchet struct {
+	count int
+	ramp  float64
+	pitch float64
+}
+
+// StepRatchet parses the ratchet of step i in the ratchet line: a digit
+// N retriggers the step N times, and [N>] or [N<] fades the velocity
+// of the retriggers out or in; a trailing signed number like [N+2] or
+// [N>-1] moves each retrigger by that many semitones.
+func (t *Track) StepRatchet(i int) Ratchet {
+	tokens := stepTokens(t.Data(ratchetCode))
+	if i >= len(tokens) {
+		return Ratchet{count: 1}
+	}
+	token := tokens[i]
+	if token[0] == '[' {
+		token = strings.Trim(token, "[]")
+	}
+	digits := len(token) - len(strings.TrimLeft(token, "0123456789"))
+	n, err := strconv.Atoi(token[:digits])
+	if err != nil || n < 1 {
+		return Ratchet{count: 1}
+	}
+	r := Ratchet{count: n, ramp: 1}
+	rest := token[digits:]
+	if rest != "" && n > 1 {
+		switch rest[0] {
+		case '>':
+			r.ramp = math.Pow(1.0/float64(n), 1/float64(n-1))
+			rest = rest[1:]
+		case '<':
+			r.ramp = math.Pow(float64(n), 1/float64(n-1))
+			rest = rest[1:]
+		}
+	}
+	if rest != "" {
+		r.pitch, _ = strconv.ParseFloat(rest, 64)
+	}
+	return r
+}
+
+// ratchet splits the notes triggered on one step into the retriggers of
+// its ratchet; a fade in starts at 1/N of the velocity.
+func (t *Track) ratchet(notes []Note) []Note {
+	if len(notes) == 0 {
+		return notes
+	}
+	r := t.StepRatchet(notes[0].Step)
+	if r.count < 2 {
+		return notes
+	}
+	gain := 1.0
+	if r.ramp > 1 {
+		gain = 1 / float64(r.count)
+	}
+	var out []Note
+	for k := range r.count {
+		start := k * notes[0].Length / r.count
+		end := (k + 1) * notes[0].Length / r.count
+		for _, n := range notes {
+			n.Start += start
+			n.Length = end - start
+			n.Key += float64(k) * r.pitch
+			n.Velocity *= gain
+			out = append(out, n)
+		}
+		gain *= r.ramp
+	}
+	return out
+}
+
+// step character extending the notes of the previous step
+const tieChar = '-'
+
+// step character releasing the notes of the previous step
+const noteOffChar = '^'
+
+// length of the fade out of one-shot voices cut by a note-off (seconds)
+const noteOffFade = 0.005
+
+// NoteLine returns the notes triggered by data line code, transposed by
+// base, arpeggiated by the arpeggiator of the track, strummed and
+// humanized.
+func (t *Track) NoteLine(code rune, base float64) []Note {
+	var notes []Note
+	held := 0 // index of the first note which a tie extends
+	for _, slot := range t.stepSlots(t.Data(code), t.noteTokens) {
+		if slot.token[0] == tieChar {
+			for j := held; j < len(notes); j++ {
+				notes[j].Length += slot.length
+			}
+			continue
+		}
+		if slot.token[0] == noteOffChar {
+			for j := held; j < len(notes); j++ {
+				notes[j].cut(slot.start)
+			}
+			held = len(notes)
+			continue
+		}
+		held = len(notes)
+		v := t.StepVelocity(slot.step)
+		if v == 0 || !t.StepFires(slot.step) {
+			continue
+		}
+		var chord []Note
+		for _, key := range stepKeys(t.mapToken(slot.token), base, t.scale) {
+			chord = append(chord, t.accent(Note{
+				Step:     slot.step,
+				Start:    slot.start,
+				Length:   slot.length,
+				Key:      key + t.transpose,
+				Velocity: v,
+			}))
+		}
+		notes = append(notes, t.ratchet(chord)...)
+		held = len(notes) - len(chord)
+	}
+	if t.arp != nil {
+		notes = t.arp.Apply(t, notes)
+	}
+	return t.humanizeNotes(t.strumNotes(notes))
+}
+
+// data line code holding the hits of percussive tracks
+const triggerCode = 'x'
+
+// hexDigit returns the value of hex digit c or -1 if it isn't one
+func hexDigit(c byte) int {
+	return strings.IndexByte("0123456789abcdef", c|0x20)
+}
+
+// velocity returns the velocity of a hit character: hex digits map
+// 1..f to increasing velocities, any other character hits at full.
+func velocity(c byte) float64 {
+	if d := hexDigit(c); d != -1 {
+		return float64(d) / 15
+	}
+	return 1
+}
+
+// Triggers returns a note of one step length for each hit in data line
+// code; '.', '·' and ' ' are rests, '-' ties the previous hit over the step
+// and '^' releases it, fading out one-shot sounds. Hits in a tuplet like
+// (xxx) divide its steps evenly and the ratchet line retriggers hits
+// within their step. The velocity of a hit is scaled by the velocity
+// line, and humanization applies to the hits.
+func (t *Track) Triggers(code rune) []Note {
+	var notes []Note
+	held := false // whether the last note can be tied
+	for _, slot := range t.stepSlots(t.Data(code), stepTokens) {
+		c := slot.token[0]
+		if c == tieChar {
+			if held {
+				notes[len(notes)-1].Length += slot.length
+			}
+			continue
+		}
+		if c == noteOffChar {
+			if held {
+				notes[len(notes)-1].cut(slot.start)
+			}
+			held = false
+			continue
+		}
+		held = false
+		if isRest(slot.token) {
+			continue
+		}
+		v := velocity(c) * t.StepVelocity(slot.step)
+		if v == 0 || !t.StepFires(slot.step) {
+			continue
+		}
+		notes = append(notes, t.ratchet([]Note{t.accent(Note{
+			Step:     slot.step,
+			Start:    slot.start,
+			Length:   slot.length,
+			Velocity: v,
+		})})...)
+		held = true
+	}
+	return t.humanizeNotes(notes)
+}
+
+// StepData returns the first character of step i of data line code, or
+// 0 if the line is missing or too short.
+func (t *Track) StepData(code rune, i int) byte {
+	if token := t.stepToken(code, i); token != "" {
+		return token[0]
+	}
+	return 0
+}
+
+// stepToken returns step i of data line code, or "" if the line is
+// missing or too short.
+func (t *Track) stepToken(code rune, i int) string {
+	if tokens := stepTokens(t.Data(code)); i < len(tokens) {
+		return tokens[i]
+	}
+	return ""
+}
+
+// Lane is a control curve given by a data line of hex digits, one value
+// (0..1) per step, interpolated linearly between steps. Steps without a
+// digit keep the previous value.
+type Lane struct {
+	values []float64
+	starts []int // first frames of the steps
+}
+
+func (t *Track) Lane(code rune, def float64) *Lane {
+	return newLane(t.Data(code), t.stepStarts(), def)
+}
+
+func newLane(data string, starts []int, def float64) *Lane {
+	l := &Lane{
+		values: make([]float64, len(starts)-1),
+		starts: starts,
+	}
+	value := def
+	tokens := stepTokens(data)
+	for i := range l.values {
+		if i < len(tokens) {
+			if d := hexDigit(tokens[i][0]); d != -1 {
+				value = float64(d) / 15
+			}
+		}
+		l.values[i] = value
+	}
+	return l
+}
+
+// stepAt returns the index of the step containing frame given the first
+// frames of the steps
+func stepAt(starts []int, frame int) int {
+	i, found := slices.BinarySearch(starts, frame)
+	if !found {
+		i--
+	}
+	return max(i, 0)
+}
+
+// At returns the value of the lane at the given frame
+func (l *Lane) At(frame int) float64 {
+	if len(l.values) == 0 {
+		return 0
+	}
+	i := stepAt(l.starts, frame)
+	if i >= len(l.values)-1 {
+		return l.values[len(l.values)-1]
+	}
+	frac := float64(frame-l.starts[i]) / float64(max(l.starts[i+1]-l.starts[i], 1))
+	return l.values[i] + (l.values[i+1]-l.values[i])*frac
+}
+
+type ADSR struct {
+	Attack  float64 // seconds
+	Decay   float64 // seconds
+	Sustain float64 // level
+	Release float64 // seconds
+}
+
+const (
+	envAttack = iota
+	envDecay
+	envSustain
+	envRelease
+	envDone
+)
+
+type Envelope struct {
+	ADSR
+	stage       int
+	level       float64
+	releaseRate float64
+}
+
+func NewEnvelope(adsr ADSR) *Envelope {
+	return &Envelope{ADSR: adsr}
+}
+
+func (e *Envelope) Next(gate bool) float64 {
+	dt := 1 / float64(sr)
+	if !gate && e.stage < envRelease {
+		e.stage = envRelease
+		if e.Release > 0 {
+			e.releaseRate = e.level * dt / e.Release
+		} else {
+			e.releaseRate = e.level
+		}
+	}
+	switch e.stage {
+	case envAttack:
+		if e.Attack > 0 {
+			e.level += dt / e.Attack
+		} else {
+			e.level = 1
+		}
+		if e.level >= 1 {
+			e.level = 1
+			e.stage = envDecay
+		}
+	case envDecay:
+		if e.Decay > 0 {
+			e.level -= (1 - e.Sustain) * dt / e.Decay
+		} else {
+			e.level = e.Sustain
+		}
+		if e.level <= e.Sustain {
+			e.level = e.Sustain
+			e.stage = envSustain
+		}
+	case envSustain:
+		e.level = e.Sustain
+	case envRelease:
+		e.level -= e.releaseRate
+		if e.level <= 0 {
+			e.level = 0
+			e.stage = envDone
+		}
+	}
+	return e.level
+}
+
+// Retrigger restarts the attack from the current level
+func (e *Envelope) Retrigger() {
+	e.stage = envAttack
+}
+
+func (e *Envelope) Done() bool {
+	return e.stage == envDone
+}
+
+// Voice renders a single note one stereo frame at a time. gate is true
+// while the note is held.
+type Voice interface {
+	Next(gate bool) (l, r float64)
+	Done() bool
+}
+
+// OneShot is implemented by voices which play to their end regardless
+// of the gate, so a note-off fades them out instead.
+type OneShot interface {
+	OneShot()
+}
+
+// renderNotes mixes a voice for each note into buf. Voices keep playing
+// after their gate closes until they are done or the buffer ends.
+func renderNotes(buf SampleBuffer, notes []Note, newVoice func(n Note) Voice) {
+	frames := len(buf) / nchannels
+	fade := int(noteOffFade * float64(sr))
+	for _, n := range notes {
+		v := newVoice(n)
+		_, oneShot := v.(OneShot)
+		cut := oneShot && n.Stop > 0
+		end := frames
+		if cut {
+			end = min(end, n.Stop+fade)
+		}
+		for i := n.Start; i < end; i++ {
+			if v.Done() {
+				break
+			}
+			gate := i < n.Start+n.Length && (n.Stop == 0 || i < n.Stop)
+			l, r := v.Next(gate)
+			if cut && i >= n.Stop {
+				g := 1 - float64(i-n.Stop)/float64(fade)
+				l, r = l*g, r*g
+			}
+			buf[i*nchannels] += l
+			buf[i*nchannels+1] += r
+		}
+	}
+}
+
+type BasicSynth struct {
+	note float64 // key of the first note character
+	adsr ADSR
+	gain float64
+}
+
+func basicSynthFactory(args string) (Processor, error) {
+	a := parseArgs(args, "note", "attack", "decay", "sustain", "release", "gain")
+	s := &BasicSynth{
+		note: a.Key("note", 60),
+		adsr: ADSR{
+			Attack:  a.Float("attack", 0.005),
+			Decay:   a.Float("decay", 0.1),
+			Sustain: a.Float("sustain", 0.7),
+			Release: a.Float("release", 0.1),
+		},
+		gain: a.Float("gain", 0.5),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *BasicSynth) Process(t *Track, buf SampleBuffer) {
+	renderNotes(buf, t.Notes(s.note), func(n Note) Voice {
+		return &oscVoice{
+			osc:  NewUnisonOscillator(Sine, Unison{Voices: 1}),
+			freq: noteFreq(n.Key),
+			env:  NewEnvelope(s.adsr),
+			gain: s.gain * n.Velocity,
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+// envVoice outputs the level of its envelope
+type envVoice struct {
+	env *Envelope
+}
+
+func (v *envVoice) Next(gate bool) (l, r float64) {
+	level := v.env.Next(gate)
+	return level, level
+}
+
+func (v *envVoice) Done() bool {
+	return v.env.Done()
+}
+
+func TestNoteOffReleases(t *testing.T) {
+	frames := int(sr)
+	stop := frames / 10
+	buf := NewSampleBuffer(frames)
+	notes := []Note{{Length: frames, Velocity: 1, Stop: stop}}
+	renderNotes(buf, notes, func(n Note) Voice {
+		return &envVoice{NewEnvelope(ADSR{Sustain: 1, Release: 0.5})}
+	})
+	level := func(seconds float64) float64 {
+		return buf[(stop+int(seconds*float64(sr)))*nchannels]
+	}
+	for _, test := range []struct {
+		seconds, want float64
+	}{
+		{-0.01, 1},
+		{0.25, 0.5},
+		{0.6, 0},
+	} {
+		if got := level(test.seconds); math.Abs(got-test.want) > 0.01 {
+			t.Errorf("level %gs after the note-off: got %g, want %g", test.seconds, got, test.want)
+		}
+	}
+}
+
+// oneShotVoice plays at full level until it is cut
+type oneShotVoice struct{}
+
+func (v oneShotVoice) Next(gate bool) (l, r float64) { return 1, 1 }
+func (v oneShotVoice) Done() bool                    { return false }
+func (v oneShotVoice) OneShot()                      {}
+
+func TestNoteOffFadesOneShots(t *testing.T) {
+	frames := int(sr)
+	stop := frames / 10
+	buf := NewSampleBuffer(frames)
+	notes := []Note{{Length: frames / 20, Velocity: 1, Stop: stop}}
+	renderNotes(buf, notes, func(n Note) Voice { return oneShotVoice{} })
+	if got := buf[(stop-1)*nchannels]; got != 1 {
+		t.Errorf("level before the note-off: got %g, want 1", got)
+	}
+	if got := buf[(stop+int(noteOffFade*float64(sr)))*nchannels]; got != 0 {
+		t.Errorf("level after the fade: got %g, want 0", got)
+	}
+}
+
+func TestStepTokens(t *testing.T) {
+	got := stepTokens("x·[C#4]{Am}(xx)é.")
+	want := []string{"x", "·", "[C#4]", "{Am}", "(xx)", "é", "."}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMultibyteRests(t *testing.T) {
+	track := testTrack()
+	track.steps = 4
+	track.data[triggerCode] = "x·x."
+	track.data[accentCode] = "·a. "
+	notes := track.Triggers(triggerCode)
+	if len(notes) != 2 || notes[0].Step != 0 || notes[1].Step != 2 {
+		t.Fatalf("got hits %v, want steps 0 and 2", notes)
+	}
+	for i, want := range []bool{false, true, false, false} {
+		if got := track.StepAccent(i); got != want {
+			t.Errorf("accent of step %d: got %v, want %v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"math"
+)
+
+// wow and flutter rates (Hz)
+const (
+	wowRate     = 0.6
+	flutterRate = 7
+)
+
+// Tape emulates tape recording: soft saturation, high frequency loss
+// and slow (wow) and fast (flutter) pitch drift.
+type Tape struct {
+	drive   float64
+	tone    float64 // rolloff cutoff (Hz)
+	wow     float64 // cents
+	flutter float64 // cents
+	gain    float64
+	lines   [2]*DelayLine
+	filters [2]SVF
+	wowLFO  *LFO
+	flutLFO *LFO
+}
+
+func tapeFactory(args string) (Processor, error) {
+	a := parseArgs(args, "drive", "tone", "wow", "flutter", "gain")
+	tp := &Tape{
+		drive:   a.Float("drive", 1.5),
+		tone:    a.Float("tone", 9000),
+		wow:     a.Float("wow", 8),
+		flutter: a.Float("flutter", 3),
+		gain:    a.Float("gain", 1),
+		wowLFO:  NewLFO(Sine, wowRate),
+		flutLFO: NewLFO(Sine, flutterRate),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	return tp, nil
+}
+
+// sweep returns the delay amplitude (frames) of a sine modulation at
+// rate giving a pitch deviation of cents
+func sweep(cents, rate float64) float64 {
+	return (math.Pow(2, cents/1200) - 1) * float64(sr) / (2 * math.Pi * rate)
+}
+
+func (tp *Tape) Process(t *Track, buf SampleBuffer) {
+	wow := sweep(tp.wow, wowRate)
+	flutter := sweep(tp.flutter, flutterRate)
+	size := int(2*(wow+flutter)) + 2
+	for c := range tp.lines {
+		if tp.lines[c] == nil {
+			tp.lines[c] = NewDelayLine(size)
+		}
+	}
+	norm := 1.0
+	if tp.drive > 0 {
+		norm = 1 / math.Tanh(tp.drive)
+	}
+	for i := 0; i < len(buf); i += nchannels {
+		delay := 1 + wow*(1+tp.wowLFO.Next()) + flutter*(1+tp.flutLFO.Next())
+		for c := range tp.lines {
+			x := buf[i+c]
+			if tp.drive > 0 {
+				x = math.Tanh(x*tp.drive) * norm
+			}
+			x, _, _ = tp.filters[c].Process(x, tp.tone, 0)
+			tp.lines[c].Write(x)
+			buf[i+c] = tp.lines[c].Read(delay) * tp.gain
+		}
+	}
+}
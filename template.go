@@ -0,0 +1,29 @@
+package main
+
+import "strings"
+
+// TrackTemplate is a track defined by a deftrack block: a processor with
+// its arguments and effects, and the lines following it, which are
+// replayed in each track instantiating the template.
+type TrackTemplate struct {
+	spec  string
+	lines []Line
+}
+
+// processor returns the processor of a track instantiating the template
+// with additional arguments and effects; named arguments override those
+// of the template.
+func (tmpl *TrackTemplate) processor(args string, effects []string) (string, string, []string) {
+	spec, chain, _ := strings.Cut(tmpl.spec, "|")
+	name, tmplArgs, _ := strings.Cut(spec, ":")
+	if tmplArgs != "" && args != "" {
+		args = tmplArgs + ":" + args
+	} else if args == "" {
+		args = tmplArgs
+	}
+	var all []string
+	if chain != "" {
+		all = strings.Split(chain, "|")
+	}
+	return name, args, append(all, effects...)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"math"
+)
+
+// Follower is an envelope follower with separate attack and release.
+type Follower struct {
+	attack  float64 // smoothing coefficients
+	release float64
+	env     float64
+}
+
+func NewFollower(attack, release float64) *Follower {
+	return &Follower{attack: coeff(attack), release: coeff(release)}
+}
+
+func (f *Follower) Next(x float64) float64 {
+	x = math.Abs(x)
+	if x > f.env {
+		f.env = x + f.attack*(f.env-x)
+	} else {
+		f.env = x + f.release*(f.env-x)
+	}
+	return f.env
+}
+
+// TransientShaper boosts or cuts the onsets and tails of sounds. Onsets
+// are found where a fast envelope rises above a slow one, tails where a
+// slowly releasing envelope stays above a fast releasing one; the gain
+// follows their ratio in dB scaled by the attack and sustain amounts.
+type TransientShaper struct {
+	attack   float64 // onset amount (-1..1)
+	sustain  float64 // tail amount (-1..1)
+	gain     float64
+	fast     *Follower
+	slow     *Follower
+	longRel  *Follower
+	shortRel *Follower
+}
+
+func transientFactory(args string) (Processor, error) {
+	a := parseArgs(args, "attack", "sustain", "gain")
+	s := &TransientShaper{
+		attack:   a.Float("attack", 0.5),
+		sustain:  a.Float("sustain", 0),
+		gain:     a.Float("gain", 1),
+		fast:     NewFollower(0.0005, 0.1),
+		slow:     NewFollower(0.03, 0.1),
+		longRel:  NewFollower(0.001, 0.3),
+		shortRel: NewFollower(0.001, 0.03),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *TransientShaper) Process(t *Track, buf SampleBuffer) {
+	const floor = 1e-6
+	for i := 0; i < len(buf); i += nchannels {
+		x := max(math.Abs(buf[i]), math.Abs(buf[i+1]))
+		onset := 20 * math.Log10((s.fast.Next(x)+floor)/(s.slow.Next(x)+floor))
+		tail := 20 * math.Log10((s.longRel.Next(x)+floor)/(s.shortRel.Next(x)+floor))
+		db := min(max(s.attack*onset+s.sustain*tail, -24), 24)
+		g := math.Pow(10, db/20) * s.gain
+		buf[i] *= g
+		buf[i+1] *= g
+	}
+}
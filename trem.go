@@ -0,0 +1,36 @@
+package main
+
+// Tremolo modulates the amplitude of the signal with a tempo-synced LFO.
+type Tremolo struct {
+	wave   Waveform
+	period Duration // LFO period
+	depth  float64  // 0..1
+	lfo    *LFO
+}
+
+func tremFactory(args string) (Processor, error) {
+	a := parseArgs(args, "period", "depth", "wave")
+	wave, err := parseWaveform(a.String("wave", "sine"))
+	if err != nil {
+		return nil, err
+	}
+	tr := &Tremolo{
+		wave:   wave,
+		period: a.Duration("period", "2"),
+		depth:  a.Float("depth", 0.5),
+		lfo:    NewLFO(wave, 0),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
+
+func (tr *Tremolo) Process(t *Track, buf SampleBuffer) {
+	tr.lfo.Sync(t, tr.period)
+	for i := 0; i < len(buf); i += nchannels {
+		g := 1 - tr.depth*(1-tr.lfo.Next())/2
+		buf[i] *= g
+		buf[i+1] *= g
+	}
+}
@@ -1,30 +1,66 @@
 package main
 
 import (
-	"bufio"
 	"flag"
 	"fmt"
 	"github.com/go-audio/audio"
 	"github.com/go-audio/wav"
+	"maps"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"regexp"
 	"slices"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 var bpm float64 = 120
+
+// tempo reached at the end of a track when ramping, 0 = constant tempo
+var bpmEnd float64
 var nchannels int = 2
 var sr int64 = 48000
 
 var steps int = 16
-var step float64 = 1 / 4
+var step float64 = 1.0 / 4
+
+// percentage of a pair of steps taken by the first one; 50 is straight
+var swing float64 = 50
+
+// key in which note lines are written as scale degrees, nil for none
+var scale *Scale
+
+// semitones by which notes are shifted
+var transpose float64
+
+// meanings of data characters set by map directives
+var charMap = make(map[string]string)
+
+// source of the random seeds of tracks, reset for each song and by seed
+// directives so that renders are reproducible
+var seeds *rand.Rand
+
+// directory of the song file (or included file) being parsed
+var songDir string
+
+// songPath resolves a path given in a song file relative to the song
+func songPath(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(songDir, name)
+}
 
 type SampleBuffer []float64
 
-func NewSampleBuffer() SampleBuffer {
-	return make([]float64, 0)
+// length of the release and effect tails running past the end of a
+// pattern into the next ones (seconds)
+const patternTail = 4
+
+func NewSampleBuffer(frames int) SampleBuffer {
+	return make([]float64, frames*nchannels)
 }
 
 func (buf SampleBuffer) Clear() {
@@ -37,16 +73,40 @@ type Processor interface {
 	Process(t *Track, buf SampleBuffer)
 }
 
-type DataLines map[byte]string
+type DataLines map[rune]string
 
 type Track struct {
 	factory ProcessorFactory
 	proc    Processor
 	clear   bool
+	name    string // optional, for referencing the track from others
+	effect  bool   // whether proc transforms the buffer instead of adding to it
+	mute    bool
+	solo    bool
+	silent  bool // muted, or not soloed while others are
+	mix     *Mix // pattern being rendered
 	data    DataLines
-	bpm     float64
-	step    float64 // length of a step (in beats)
-	steps   int     // number of steps in the track
+	sources map[rune]Line // lines setting the data lines
+	used    map[rune]bool // codes of the data lines read by the processor
+	// automation and parameter lock lines by parameter name
+	automation map[string]AutomationLine
+	locks      map[string]AutomationLine
+	bpm        float64
+	bpmEnd     float64 // tempo reached at the end, 0 = constant
+	step       float64 // length of a step (in beats)
+	steps      int     // number of steps in the track
+	swing      float64 // percentage of a pair of steps taken by the first one
+	scale      *Scale  // key of the note lines, nil for semitones
+	transpose  float64 // semitones
+	charMap    map[string]string
+	groove     *Groove
+	arp        *Arp
+	strum      float64 // seconds
+	humanize   Humanize
+	polymeter  bool // whether the track repeats to fill longer patterns
+	play       int  // number of earlier plays of the pattern
+	fill       bool // whether the pattern isn't repeated right after
+	rng        *rand.Rand
 }
 
 func (t *Track) BeatsPerSecond() float64 {
@@ -62,178 +122,1192 @@ func (t *Track) SamplesPerStep() int {
 }
 
 func (t *Track) Frames() int {
-	return t.SamplesPerStep() * t.steps
+	return t.gridStart(t.steps)
+}
+
+// tempo returns the tempo of step i, ramping linearly from bpm to bpmEnd
+// over the steps of the track
+func (t *Track) tempo(i int) float64 {
+	if t.bpmEnd == 0 || t.steps == 0 {
+		return t.bpm
+	}
+	return t.bpm + (t.bpmEnd-t.bpm)*float64(min(i, t.steps))/float64(t.steps)
+}
+
+// gridStart returns the first frame of step i without swing
+func (t *Track) gridStart(i int) int {
+	if t.bpmEnd == 0 {
+		return t.SamplesPerStep() * i
+	}
+	frames := 0.0
+	for j := 0; j < i; j++ {
+		frames += float64(sr) * 60 / t.tempo(j) * t.step
+	}
+	return int(frames)
+}
+
+// stepStarts returns the first frames of the steps of the track without
+// swing, followed by the end of the track
+func (t *Track) stepStarts() []int {
+	starts := make([]int, t.steps+1)
+	for i := range starts {
+		starts[i] = t.gridStart(i)
+	}
+	return starts
+}
+
+// StepFrames returns the length of step i
+func (t *Track) StepFrames(i int) int {
+	return t.gridStart(i+1) - t.gridStart(i)
+}
+
+// data line code holding per-step micro-timing
+const microCode = 'u'
+
+// StepStart returns the first frame of step i; odd steps are delayed by
+// swing and shifted by the groove, and a hex digit in the micro-timing
+// line nudges the step by sixteenths of its length, 8 being on the grid,
+// 0 half a step early and f 7/16 late.
+func (t *Track) StepStart(i int) int {
+	start := t.gridStart(i)
+	if i%2 == 1 {
+		start += int((t.swing/50 - 1) * float64(t.StepFrames(i)))
+	}
+	if t.groove != nil {
+		start += t.groove.Offset(t, i)
+	}
+	if d := hexDigit(t.StepData(microCode, i)); d != -1 {
+		start += (d - 8) * t.StepFrames(i) / 16
+	}
+	return max(start, 0)
 }
 
 func (t *Track) Process(buf SampleBuffer) {
 	t.proc.Process(t, buf)
 }
 
+// Tap returns the output of the named track of the same pattern, or nil
+// if there is no such track.
+func (t *Track) Tap(name string) SampleBuffer {
+	if t.mix == nil {
+		return nil
+	}
+	return t.mix.Output(name)
+}
+
 type Pattern []*Track
 type Song []Pattern
 
+// Referrer is implemented by processors which tap other tracks.
+type Referrer interface {
+	Refs() []string
+}
+
+// Mix renders the tracks of a pattern, keeping the output of named
+// tracks so that other tracks can tap them. The output of a track is
+// what it adds to the pattern buffer; a track referenced before its
+// turn is rendered on silence in advance.
+type Mix struct {
+	pattern Pattern
+	frames  int
+	outputs map[*Track]SampleBuffer
+	pending map[*Track]bool
+}
+
+func NewMix(pattern Pattern, frames int) *Mix {
+	return &Mix{
+		pattern: pattern,
+		frames:  frames,
+		outputs: make(map[*Track]SampleBuffer),
+		pending: make(map[*Track]bool),
+	}
+}
+
+func (m *Mix) track(name string) *Track {
+	for _, t := range m.pattern {
+		if t.name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+func (m *Mix) Output(name string) SampleBuffer {
+	t := m.track(name)
+	if t == nil {
+		return nil
+	}
+	if out, ok := m.outputs[t]; ok {
+		return out
+	}
+	out := NewSampleBuffer(m.frames)
+	if m.pending[t] {
+		// referenced while being rendered
+		return out
+	}
+	m.pending[t] = true
+	t.mix = m
+	t.Process(out)
+	m.outputs[t] = out
+	return out
+}
+
+// Render processes all tracks of the pattern into buf; silent tracks are
+// skipped but can still be tapped
+func (m *Mix) Render(buf SampleBuffer) {
+	for _, t := range m.pattern {
+		if t.silent {
+			continue
+		}
+		if t.clear {
+			buf.Clear()
+		}
+		if out, ok := m.outputs[t]; ok {
+			for i := range buf {
+				buf[i] += out[i]
+			}
+			continue
+		}
+		t.mix = m
+		if t.name == "" {
+			t.Process(buf)
+			continue
+		}
+		m.pending[t] = true
+		before := slices.Clone(buf)
+		t.Process(buf)
+		out := NewSampleBuffer(m.frames)
+		for i := range buf {
+			out[i] = buf[i] - before[i]
+		}
+		m.outputs[t] = out
+	}
+}
+
+// names of tracks muted or soloed from the command line
+var muteNames, soloNames string
+
+// silence marks the tracks of a song which shouldn't be heard: muted
+// ones and, if any track is soloed, those which aren't
+func (s Song) silence() {
+	listed := func(names string, t *Track) bool {
+		return t.name != "" && slices.Contains(strings.Split(names, ","), t.name)
+	}
+	soloing := false
+	for _, pattern := range s {
+		for _, t := range pattern {
+			t.solo = t.solo || listed(soloNames, t)
+			t.mute = t.mute || listed(muteNames, t)
+			soloing = soloing || t.solo
+		}
+	}
+	for _, pattern := range s {
+		for _, t := range pattern {
+			t.silent = t.mute || soloing && !t.solo
+		}
+	}
+}
+
+// checkRefs verifies that the tracks referenced by the processors of a
+// pattern exist
+func (p Pattern) checkRefs() error {
+	names := make(map[string]bool)
+	for _, t := range p {
+		if t.name != "" {
+			if names[t.name] {
+				return fmt.Errorf("duplicate track name: %s", t.name)
+			}
+			names[t.name] = true
+		}
+	}
+	for _, t := range p {
+		if r, ok := t.proc.(Referrer); ok {
+			for _, name := range r.Refs() {
+				if !names[name] {
+					return fmt.Errorf("reference to unknown track: %s", name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// fit returns the pattern with its polymetric tracks repeated to cover
+// frames
+func (p Pattern) fit(frames int) Pattern {
+	fitted := make(Pattern, len(p))
+	for i, t := range p {
+		fitted[i] = t
+		if t.polymeter && t.Frames() < frames {
+			fitted[i] = t.repeat((frames + t.SamplesPerStep() - 1) / max(t.SamplesPerStep(), 1))
+		}
+	}
+	return fitted
+}
+
+// repeat returns a copy of the track extended to n steps by repeating
+// its data lines
+func (t *Track) repeat(n int) *Track {
+	cycle := func(data string) string {
+		var tokens []string
+		width := 0
+		for _, token := range t.noteTokens(data) {
+			if width >= t.steps {
+				break
+			}
+			tokens = append(tokens, token)
+			width += stepWidth(token, t.noteTokens)
+		}
+		for ; width < t.steps; width++ {
+			tokens = append(tokens, ".")
+		}
+		var sb strings.Builder
+		for i, width := 0, 0; width < n; i++ {
+			sb.WriteString(tokens[i%len(tokens)])
+			width += stepWidth(tokens[i%len(tokens)], t.noteTokens)
+		}
+		return sb.String()
+	}
+	r := *t
+	r.steps = n
+	r.data = make(DataLines)
+	for code, data := range t.data {
+		r.data[code] = cycle(data)
+	}
+	r.automation = make(map[string]AutomationLine)
+	for name, line := range t.automation {
+		line.data = cycle(line.data)
+		r.automation[name] = line
+	}
+	r.locks = make(map[string]AutomationLine)
+	for name, line := range t.locks {
+		line.data = cycle(line.data)
+		r.locks[name] = line
+	}
+	return &r
+}
+
 type ProcessorFactory func(args string) (Processor, error)
 
-func basicSynthFactory(args string) (Processor, error) {
-	return nil, nil
+// named arguments set by defaults directives for the processors
+// instantiated after them
+var processorDefaults = make(map[string]map[string]string)
+
+// defaults of the processor being instantiated, which parseArgs takes
+// before the arguments given
+var argDefaults map[string]string
+
+// withDefaults returns factory instantiating processor name with its
+// defaults, which the arguments override
+func withDefaults(name string, factory ProcessorFactory) ProcessorFactory {
+	return func(args string) (Processor, error) {
+		argDefaults = processorDefaults[name]
+		defer func() { argDefaults = nil }()
+		return factory(args)
+	}
+}
+
+func newTrack(factory ProcessorFactory, proc Processor, clear bool, name string) *Track {
+	return &Track{
+		factory:    factory,
+		proc:       proc,
+		clear:      clear,
+		name:       name,
+		data:       make(DataLines),
+		sources:    make(map[rune]Line),
+		used:       make(map[rune]bool),
+		automation: make(map[string]AutomationLine),
+		locks:      make(map[string]AutomationLine),
+		bpm:        bpm,
+		bpmEnd:     bpmEnd,
+		step:       step,
+		steps:      steps,
+		swing:      swing,
+		scale:      scale,
+		transpose:  transpose,
+		charMap:    maps.Clone(charMap),
+		groove:     groove,
+		arp:        arp,
+		strum:      strum,
+		humanize:   humanize,
+		rng:        rand.New(rand.NewSource(seeds.Int63())),
+	}
 }
 
 var processorFactories = map[string]ProcessorFactory{
-	"basic": basicSynthFactory,
+	"basic":       basicSynthFactory,
+	"osc":         oscSynthFactory,
+	"additive":    additiveSynthFactory,
+	"sub":         subSynthFactory,
+	"wavetable":   wavetableSynthFactory,
+	"grain":       grainSynthFactory,
+	"kick":        kickFactory,
+	"snare":       snareFactory,
+	"hat":         hatFactory,
+	"clap":        clapFactory,
+	"drums":       drumKitFactory,
+	"sample":      samplePlayerFactory,
+	"multisample": multiSampleFactory,
+	"sfz":         sfzFactory,
+	"pulse":       pulseSynthFactory,
+	"sync":        syncSynthFactory,
+	"ringmod":     ringModFactory,
+	"formant":     formantSynthFactory,
+	"speak":       speakSynthFactory,
+	"modal":       modalSynthFactory,
+	"nes":         nesFactory,
+	"sid":         sidFactory,
+	"organ":       organFactory,
+	"vector":      vectorSynthFactory,
+	"waveseq":     waveSeqFactory,
+	"bytebeat":    bytebeatFactory,
+	"delay":       delayFactory,
+	"reverb":      reverbFactory,
+	"filter":      filterFactory,
+	"eq":          eqFactory,
+	"comp":        compFactory,
+	"dist":        distFactory,
+	"crush":       crushFactory,
+	"chorus":      chorusFactory,
+	"flanger":     flangerFactory,
+	"phaser":      phaserFactory,
+	"trem":        tremFactory,
+	"vibrato":     vibratoFactory,
+	"autopan":     autoPanFactory,
+	"width":       widthFactory,
+	"tape":        tapeFactory,
+	"gate":        gateFactory,
+	"pitch":       pitchFactory,
+	"stutter":     stutterFactory,
+	"vocoder":     vocoderFactory,
+	"autowah":     autoWahFactory,
+	"graindelay":  grainDelayFactory,
+	"shimmer":     shimmerFactory,
+	"mbcomp":      mbcompFactory,
+	"transient":   transientFactory,
+	"exciter":     exciterFactory,
+}
+
+// Args holds processor arguments given as a colon-separated list of
+// positional values and name=value pairs. Parse errors are collected
+// and reported by Err.
+type Args struct {
+	values map[string]string
+	err    error
+}
+
+var argNamePattern = regexp.MustCompile(`^\s*\w+\s*$`)
+
+func parseArgs(args string, names ...string) *Args {
+	a := &Args{values: make(map[string]string)}
+	for name, value := range argDefaults {
+		if !slices.Contains(names, name) {
+			a.fail(fmt.Errorf("unknown argument: %s", name))
+			continue
+		}
+		a.values[name] = value
+	}
+	// the defaults are for the arguments of the processor only
+	argDefaults = nil
+	if args == "" {
+		return a
+	}
+	for i, field := range strings.Split(args, ":") {
+		field = strings.TrimSpace(field)
+		if name, value, ok := strings.Cut(field, "="); ok && argNamePattern.MatchString(name) && !strings.HasPrefix(value, "=") {
+			name = strings.TrimSpace(name)
+			if !slices.Contains(names, name) {
+				a.fail(fmt.Errorf("unknown argument: %s", name))
+				continue
+			}
+			a.values[name] = strings.TrimSpace(value)
+		} else if i >= len(names) {
+			a.fail(fmt.Errorf("too many arguments: %s", args))
+		} else if field != "" {
+			a.values[names[i]] = field
+		}
+	}
+	return a
+}
+
+func (a *Args) fail(err error) {
+	if a.err == nil {
+		a.err = err
+	}
+}
+
+func (a *Args) Err() error {
+	return a.err
+}
+
+func (a *Args) String(name string, def string) string {
+	if value, ok := a.values[name]; ok {
+		return value
+	}
+	return def
+}
+
+func (a *Args) Float(name string, def float64) float64 {
+	s, ok := a.values[name]
+	if !ok {
+		return def
+	}
+	value, err := parseFloat(s)
+	if err != nil {
+		a.fail(fmt.Errorf("cannot parse %s value: %s: %w", name, s, err))
+		return def
+	}
+	return value
+}
+
+// Key returns a key given as MIDI number or note name
+func (a *Args) Key(name string, def float64) float64 {
+	s, ok := a.values[name]
+	if !ok {
+		return def
+	}
+	value, err := parseKey(s)
+	if err != nil {
+		a.fail(fmt.Errorf("cannot parse %s value: %s: %w", name, s, err))
+		return def
+	}
+	return value
+}
+
+// Floats parses a comma-separated list of numbers
+func (a *Args) Floats(name string, def []float64) []float64 {
+	s, ok := a.values[name]
+	if !ok {
+		return def
+	}
+	var values []float64
+	for _, field := range strings.Split(s, ",") {
+		value, err := parseFloat(strings.TrimSpace(field))
+		if err != nil {
+			a.fail(fmt.Errorf("cannot parse %s value: %s: %w", name, s, err))
+			return def
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// Duration is a length of time given in steps (no suffix), beats (b
+// suffix) or milliseconds (ms suffix), so tempo-synced values can be
+// converted once the track is known. In expressions, step is the length
+// of a step in the unit of the duration.
+type Duration struct {
+	value float64
+	unit  string
+}
+
+func parseDuration(s string) (Duration, error) {
+	var d Duration
+	for _, unit := range []string{"ms", "b"} {
+		if strings.HasSuffix(s, unit) {
+			d.unit = unit
+			s = strings.TrimSuffix(s, unit)
+			break
+		}
+	}
+	stepLength := 1.0
+	switch d.unit {
+	case "b":
+		stepLength = step
+	case "ms":
+		stepLength = step * 60000 / bpm
+	}
+	value, err := evalExpr(s, stepLength)
+	if err != nil {
+		return d, err
+	}
+	d.value = value
+	return d, nil
 }
 
-func parseFloat(s string) (float64, error) {
-	slashIndex := strings.IndexByte(s, '/')
-	if slashIndex == -1 {
-		return strconv.ParseFloat(s, 64)
+// Frames returns the length of the duration on track t
+func (d Duration) Frames(t *Track) float64 {
+	switch d.unit {
+	case "b":
+		return d.value * t.SamplesPerBeat()
+	case "ms":
+		return d.value * float64(sr) / 1000
 	}
-	nom, err := strconv.ParseFloat(s[:slashIndex], 64)
+	return d.value * t.SamplesPerBeat() * t.step
+}
+
+func (a *Args) Duration(name string, def string) Duration {
+	s, ok := a.values[name]
+	if !ok {
+		s = def
+	}
+	d, err := parseDuration(s)
 	if err != nil {
-		return 0, err
+		a.fail(fmt.Errorf("cannot parse %s value: %s: %w", name, s, err))
 	}
-	denom, err := strconv.ParseFloat(s[slashIndex+1:], 64)
+	return d
+}
+
+func (a *Args) Int(name string, def int) int {
+	s, ok := a.values[name]
+	if !ok {
+		return def
+	}
+	value, err := parseInt(s)
 	if err != nil {
-		return 0, err
+		a.fail(fmt.Errorf("cannot parse %s value: %s: %w", name, s, err))
+		return def
 	}
-	return nom / denom, nil
+	return value
 }
 
-func processFile(filename string) error {
-	f, err := os.Open(filename)
+func processFile(filename string) (err error) {
+	lines, err := readLines(filename)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	// errors while parsing are reported with the position and content
+	// of the offending line
+	var current *Line
+	defer func() {
+		if err != nil && current != nil {
+			err = fmt.Errorf("%s:%d: %w\n\t%s", current.file, current.num, err, current.text)
+		}
+	}()
+	// in strict mode, problems which are otherwise warned about are
+	// errors
+	strict := strictMode
+	warn := func(err error) error {
+		if strict {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%s:%d: warning: %v\n", current.file, current.num, err)
+		return nil
+	}
+	// the settings of a song don't carry over to the next one
+	bpm, bpmEnd, sr = 120, 0, 48000
+	steps, step = 16, 1.0/4
+	seeds = rand.New(rand.NewSource(1))
+	tuning = nil
+	groove = nil
+	arp = nil
+	processorDefaults = make(map[string]map[string]string)
+	strum = 0
+	humanize = Humanize{}
+	transpose = 0
+	swing = 50
+	scale = nil
+	charMap = make(map[string]string)
+	// source of random expressions, reset with seeds by seed directives
+	variation := rand.New(rand.NewSource(1))
 	var song Song
 	var pattern Pattern
 	var track *Track
-	scanner := bufio.NewScanner(f)
+	var limiter *Limiter
+	var patternName string
+	repeats := 1
+	named := make(map[string]Song)
+	var arrangement []string
+	templates := make(map[string]*TrackTemplate)
+	// positions in the song of the sections marked by labels and of the
+	// segno and to coda (or fine) signs, -1 if not given
+	labels := make(map[string]int)
+	segno, toCoda := -1, -1
+	// replay appends the patterns from start to end again
+	replay := func(start, end int) {
+		song = append(song, slices.Clone(song[start:end])...)
+	}
+	var defining *TrackTemplate // template whose lines are being read
+	// tempo to restore after a pattern with its own
+	var songBPM, songBPMEnd float64
+	patternTempo := false
+	// transposition to restore after a pattern with its own
+	var songTranspose float64
+	patternTranspose := false
+	endPattern := func() {
+		if track != nil {
+			pattern = append(pattern, track)
+		}
+		if pattern != nil {
+			for range repeats {
+				song = append(song, pattern)
+			}
+			if patternName != "" {
+				named[patternName] = song[len(song)-repeats:]
+			}
+		}
+		pattern, track, patternName, repeats = nil, nil, "", 1
+		if patternTempo {
+			bpm, bpmEnd, patternTempo = songBPM, songBPMEnd, false
+		}
+		if patternTranspose {
+			transpose, patternTranspose = songTranspose, false
+		}
+	}
+	variables := make(map[string]string)
 	setGlobalPattern := regexp.MustCompile(`^(bpm|sr|steps|step)\s+(.+)$`)
-	setProcessorPattern := regexp.MustCompile(`^([:+])([^:]+)?(?::(.+))?$`)
+	setSwingPattern := regexp.MustCompile(`^swing\s+(.+)$`)
+	setMapPattern := regexp.MustCompile(`^map\s+(\S)\s+(\S+)$`)
+	setKeyPattern := regexp.MustCompile(`^key\s+(.+)$`)
+	setTuningPattern := regexp.MustCompile(`^tuning\s+(\S+)(?:\s+(\S+))?$`)
+	setGroovePattern := regexp.MustCompile(`^groove\s+(\S+)$`)
+	setArpPattern := regexp.MustCompile(`^arp(?:\s+(.+))?$`)
+	setStrumPattern := regexp.MustCompile(`^strum\s+(\S+)$`)
+	setHumanizePattern := regexp.MustCompile(`^humanize\s+(.+)$`)
+	strictPattern := regexp.MustCompile(`^(strict|lenient)$`)
+	muteSoloPattern := regexp.MustCompile(`^(mute|solo)$`)
+	transposePattern := regexp.MustCompile(`^transpose\s+(\S+)$`)
+	seedPattern := regexp.MustCompile(`^seed\s+(-?\d+)$`)
+	setLimiterPattern := regexp.MustCompile(`^limiter(?:\s+(.+))?$`)
+	setVariablePattern := regexp.MustCompile(`^(?:let|define)\s+(\w+)(?:\s*=\s*|\s+)(.*)$`)
+	variablePattern := regexp.MustCompile(`\$(?:(\w+)|\{(\w+)\})`)
+	patternNamePattern := regexp.MustCompile(`^\[(\w+)\]$`)
+	repeatPattern := regexp.MustCompile(`^repeat\s+(\d+)$`)
+	arrangePattern := regexp.MustCompile(`^arrange\s+(.+)$`)
+	arrangeItemPattern := regexp.MustCompile(`^(\w+)(?:\*(\d+))?$`)
+	setProcessorPattern := regexp.MustCompile(`^(?:(\w+)=)?([:+])(.*)$`)
+	automationPattern := regexp.MustCompile(`^([~!])(\w+)(?::([^:\s]+):([^:\s]+))?\s+(.*)$`)
 	setDataPattern := regexp.MustCompile(`^(.)(.+)$`)
-	emptyLinePattern := regexp.MustCompile(`^\s+$`)
-	for scanner.Scan() {
-		line := scanner.Text()
+	emptyLinePattern := regexp.MustCompile(`^\s*$`)
+	// a line of dashes ends the pattern like a whitespace line, but
+	// survives editors stripping trailing whitespace
+	separatorPattern := regexp.MustCompile(`^\s*--+\s*$`)
+	defaultsPattern := regexp.MustCompile(`^defaults\s+(\w+)(?:\s+(.+))?$`)
+	labelPattern := regexp.MustCompile(`^label\s+(\w+)$`)
+	gotoPattern := regexp.MustCompile(`^goto\s+(\w+)(?:\*(\d+))?$`)
+	signPattern := regexp.MustCompile(`^(segno|tocoda|fine|ds|dc)$`)
+	deftrackPattern := regexp.MustCompile(`^deftrack\s+(\w+)\s+:(.+)$`)
+	for i := 0; i < len(lines); i++ {
+		l := lines[i]
+		current = &l
+		line := l.text
+		// the lines of a template end with a pattern separator
+		if defining != nil {
+			if emptyLinePattern.MatchString(line) || separatorPattern.MatchString(line) {
+				defining = nil
+			} else if setProcessorPattern.MatchString(line) {
+				return fmt.Errorf("processor line in track template")
+			} else {
+				defining.lines = append(defining.lines, l)
+			}
+			continue
+		}
+		// paths are relative to the file the line comes from
+		songDir = filepath.Dir(l.file)
+		var undefined string
+		line = variablePattern.ReplaceAllStringFunc(line, func(ref string) string {
+			m := variablePattern.FindStringSubmatch(ref)
+			name := m[1] + m[2]
+			value, ok := variables[name]
+			if !ok && undefined == "" {
+				undefined = name
+			}
+			return value
+		})
+		if undefined != "" {
+			return fmt.Errorf("undefined variable: %s", undefined)
+		}
+		if line, err = expandRandom(line, variation); err != nil {
+			return err
+		}
 		if line == ">>" {
 			song = nil
 			pattern = nil
 			track = nil
+			patternName = ""
+			repeats = 1
+			named = make(map[string]Song)
+			arrangement = nil
+			labels = make(map[string]int)
+			segno, toCoda = -1, -1
 		} else if line == "<<" {
 			break
+		} else if separatorPattern.MatchString(line) {
+			endPattern()
+		} else if matches := setMapPattern.FindStringSubmatch(line); matches != nil {
+			// within a track, the mapping applies to that track only
+			if track != nil {
+				track.charMap[matches[1]] = matches[2]
+			} else {
+				charMap[matches[1]] = matches[2]
+			}
+		} else if matches := setKeyPattern.FindStringSubmatch(line); matches != nil {
+			// "key none" goes back to semitone note characters
+			var s *Scale
+			if matches[1] != "none" {
+				if s, err = parseScale(matches[1]); err != nil {
+					return err
+				}
+			}
+			// within a track, the key applies to that track only
+			if track != nil {
+				track.scale = s
+			} else {
+				scale = s
+			}
+		} else if matches := setTuningPattern.FindStringSubmatch(line); matches != nil {
+			// the tuning applies to the whole song
+			if matches[1] == "none" {
+				tuning = nil
+			} else if tuning, err = loadTuning(matches[1], matches[2]); err != nil {
+				return err
+			}
+		} else if matches := setGroovePattern.FindStringSubmatch(line); matches != nil {
+			// "groove none" removes the groove
+			var g *Groove
+			if matches[1] != "none" {
+				if g, err = loadGroove(matches[1]); err != nil {
+					return err
+				}
+			}
+			// within a track, the groove applies to that track only
+			if track != nil {
+				track.groove = g
+			} else {
+				groove = g
+			}
+		} else if matches := setArpPattern.FindStringSubmatch(line); matches != nil {
+			// "arp none" turns the arpeggiator off
+			var p *Arp
+			if matches[1] != "none" {
+				if p, err = parseArp(matches[1]); err != nil {
+					return fmt.Errorf("cannot parse arp settings: %v", err)
+				}
+			}
+			// within a track, the arpeggiator applies to that track only
+			if track != nil {
+				track.arp = p
+			} else {
+				arp = p
+			}
+		} else if matches := setStrumPattern.FindStringSubmatch(line); matches != nil {
+			value, err := parseFloat(matches[1])
+			if err != nil {
+				return fmt.Errorf("cannot parse strum value: %s: %w", matches[1], err)
+			}
+			// within a track, strumming applies to that track only
+			if track != nil {
+				track.strum = value / 1000
+			} else {
+				strum = value / 1000
+			}
+		} else if matches := setHumanizePattern.FindStringSubmatch(line); matches != nil {
+			h, err := parseHumanize(matches[1])
+			if err != nil {
+				return err
+			}
+			// within a track, humanization applies to that track only
+			if track != nil {
+				track.humanize = h
+			} else {
+				humanize = h
+			}
+		} else if matches := deftrackPattern.FindStringSubmatch(line); matches != nil {
+			if _, ok := templates[matches[1]]; ok {
+				return fmt.Errorf("duplicate track template: %s", matches[1])
+			}
+			defining = &TrackTemplate{spec: matches[2]}
+			templates[matches[1]] = defining
+		} else if matches := strictPattern.FindStringSubmatch(line); matches != nil {
+			strict = matches[1] == "strict"
+		} else if matches := muteSoloPattern.FindStringSubmatch(line); matches != nil {
+			if track == nil {
+				return fmt.Errorf("%s outside of a track", matches[1])
+			}
+			if matches[1] == "mute" {
+				track.mute = true
+			} else {
+				track.solo = true
+			}
+		} else if matches := transposePattern.FindStringSubmatch(line); matches != nil {
+			value, err := parseFloat(strings.TrimPrefix(matches[1], "+"))
+			if err != nil {
+				return fmt.Errorf("cannot parse transpose value: %s: %w", matches[1], err)
+			}
+			// like bpm, within a track for that track only and after the
+			// name of a pattern for that pattern only
+			if track != nil {
+				track.transpose = value
+			} else {
+				if patternName != "" && !patternTranspose {
+					songTranspose, patternTranspose = transpose, true
+				}
+				transpose = value
+			}
+		} else if matches := seedPattern.FindStringSubmatch(line); matches != nil {
+			seed, _ := strconv.ParseInt(matches[1], 10, 64)
+			seeds = rand.New(rand.NewSource(seed))
+			variation = rand.New(rand.NewSource(seed))
+		} else if matches := setVariablePattern.FindStringSubmatch(line); matches != nil {
+			variables[matches[1]] = matches[2]
 		} else if matches := setGlobalPattern.FindStringSubmatch(line); matches != nil {
 			option := matches[1]
 			switch option {
+			// within a track, bpm applies to that track only; after the
+			// name of a pattern, to that pattern only. A range like
+			// 120..140 ramps the tempo over the steps of each track.
 			case "bpm":
-				if value, err := parseFloat(matches[2]); err != nil {
+				start, end, ramp := strings.Cut(matches[2], "..")
+				value, err := parseFloat(start)
+				if err != nil {
 					return fmt.Errorf("Cannot parse bpm value: %s, %w", matches[2], err)
+				}
+				endValue := 0.0
+				if ramp {
+					if endValue, err = parseFloat(end); err != nil {
+						return fmt.Errorf("Cannot parse bpm value: %s, %w", matches[2], err)
+					}
+				}
+				if track != nil {
+					track.bpm, track.bpmEnd = value, endValue
+					track.polymeter = true
 				} else {
-					bpm = value
+					if patternName != "" && !patternTempo {
+						songBPM, songBPMEnd, patternTempo = bpm, bpmEnd, true
+					}
+					bpm, bpmEnd = value, endValue
 				}
 			case "sr":
-				if value, err := strconv.ParseInt(matches[2], 10, 64); err != nil {
+				if value, err := parseInt(matches[2]); err != nil {
 					return fmt.Errorf("Cannot parse sr value: %s: %w", matches[2], err)
 				} else {
-					sr = value
+					sr = int64(value)
 				}
+			// within a track, steps and step apply to that track only,
+			// which then repeats to the length of the pattern
 			case "steps":
-				if value, err := strconv.ParseInt(matches[2], 10, 64); err != nil {
+				if value, err := parseInt(matches[2]); err != nil {
 					return fmt.Errorf("Cannot parse steps value: %s: %w", matches[2], err)
+				} else if value <= 0 {
+					return fmt.Errorf("invalid steps value: %s", matches[2])
+				} else if track != nil {
+					track.steps = value
+					track.polymeter = true
 				} else {
-					steps = int(value)
+					steps = value
 				}
 			case "step":
 				if value, err := parseFloat(matches[2]); err != nil {
 					return fmt.Errorf("Cannot parse step value: %s: %w", matches[2], err)
+				} else if value <= 0 {
+					return fmt.Errorf("invalid step value: %s", matches[2])
+				} else if track != nil {
+					track.step = value
+					track.polymeter = true
 				} else {
 					step = value
 				}
 			}
+		} else if matches := setSwingPattern.FindStringSubmatch(line); matches != nil {
+			value, err := parseFloat(matches[1])
+			if err != nil || value < 0 || value > 100 {
+				return fmt.Errorf("invalid swing value: %s", matches[1])
+			}
+			// within a track, swing applies to that track only
+			if track != nil {
+				track.swing = value
+			} else {
+				swing = value
+			}
+		} else if matches := setLimiterPattern.FindStringSubmatch(line); matches != nil {
+			if limiter, err = parseLimiter(matches[1]); err != nil {
+				return fmt.Errorf("cannot parse limiter settings: %v", err)
+			}
+		} else if matches := patternNamePattern.FindStringSubmatch(line); matches != nil {
+			endPattern()
+			if _, ok := named[matches[1]]; ok {
+				return fmt.Errorf("duplicate pattern name: %s", matches[1])
+			}
+			patternName = matches[1]
+		} else if matches := repeatPattern.FindStringSubmatch(line); matches != nil {
+			if repeats, _ = strconv.Atoi(matches[1]); repeats < 1 {
+				return fmt.Errorf("invalid repeat count: %s", matches[1])
+			}
+		} else if matches := defaultsPattern.FindStringSubmatch(line); matches != nil {
+			if _, ok := processorFactories[matches[1]]; !ok {
+				return fmt.Errorf("unknown processor: %s", matches[1])
+			}
+			// defaults add to earlier ones, without arguments they are reset
+			if matches[2] == "" {
+				delete(processorDefaults, matches[1])
+				continue
+			}
+			defaults := processorDefaults[matches[1]]
+			if defaults == nil {
+				defaults = make(map[string]string)
+				processorDefaults[matches[1]] = defaults
+			}
+			for _, field := range strings.Split(matches[2], ":") {
+				name, value, ok := strings.Cut(field, "=")
+				if !ok || !argNamePattern.MatchString(name) {
+					return fmt.Errorf("defaults must be named arguments: %s", field)
+				}
+				defaults[strings.TrimSpace(name)] = strings.TrimSpace(value)
+			}
+		} else if matches := labelPattern.FindStringSubmatch(line); matches != nil {
+			endPattern()
+			if _, ok := labels[matches[1]]; ok {
+				return fmt.Errorf("duplicate label: %s", matches[1])
+			}
+			labels[matches[1]] = len(song)
+		} else if matches := gotoPattern.FindStringSubmatch(line); matches != nil {
+			// jumps back to the label and plays up to here again, as many
+			// times as given
+			endPattern()
+			start, ok := labels[matches[1]]
+			if !ok {
+				return fmt.Errorf("unknown label: %s", matches[1])
+			}
+			count := 1
+			if matches[2] != "" {
+				count, _ = strconv.Atoi(matches[2])
+			}
+			end := len(song)
+			for range count {
+				replay(start, end)
+			}
+		} else if matches := signPattern.FindStringSubmatch(line); matches != nil {
+			endPattern()
+			switch matches[1] {
+			case "segno":
+				segno = len(song)
+			case "tocoda", "fine":
+				toCoda = len(song)
+			// dal segno and da capo jump back to the segno or the start
+			// and play up to the to coda or fine sign, continuing with
+			// the coda which follows
+			case "ds", "dc":
+				start := 0
+				if matches[1] == "ds" {
+					if segno == -1 {
+						return fmt.Errorf("ds without segno")
+					}
+					start = segno
+				}
+				end := len(song)
+				if toCoda > start {
+					end = toCoda
+				}
+				replay(start, end)
+			}
+		} else if matches := arrangePattern.FindStringSubmatch(line); matches != nil {
+			for _, item := range strings.Fields(matches[1]) {
+				m := arrangeItemPattern.FindStringSubmatch(item)
+				if m == nil {
+					return fmt.Errorf("invalid arrangement item: %s", item)
+				}
+				count := 1
+				if m[2] != "" {
+					count, _ = strconv.Atoi(m[2])
+				}
+				for range count {
+					arrangement = append(arrangement, m[1])
+				}
+			}
 		} else if matches := setProcessorPattern.FindStringSubmatch(line); matches != nil {
+			trackName := matches[1]
 			clear := true
-			if matches[1] == "+" {
+			if matches[2] == "+" {
 				clear = false
 			}
-			name := matches[2]
+			// insert effects follow the processor separated by |
+			spec, chain, _ := strings.Cut(matches[3], "|")
+			var effects []string
+			if chain != "" {
+				effects = strings.Split(chain, "|")
+			}
+			name, args, _ := strings.Cut(spec, ":")
+			// a template gives the processor of the track and lines which
+			// are read before those following
+			tmpl := templates[name]
+			if tmpl != nil {
+				name, args, effects = tmpl.processor(args, effects)
+				lines = slices.Insert(lines, i+1, tmpl.lines...)
+			}
 			if name == "" {
 				if track == nil {
 					return fmt.Errorf("attempt to reuse a processor which has not been defined")
 				}
-				args := matches[3]
-				if proc, err := track.factory(args); err != nil {
-					return fmt.Errorf("cannot instantiate processor %s: %v", name, err)
+				factory, effect := track.factory, track.effect
+				if effects != nil {
+					factory = chainFactory(factory, effects, effect)
+				}
+				if proc, err := factory(args); err != nil {
+					return fmt.Errorf("cannot instantiate processor: %v", err)
 				} else {
 					pattern = append(pattern, track)
-					track.proc = proc
-					track.data = make(DataLines)
-					track.bpm = bpm
-					track.step = step
-					track.steps = steps
+					track = newTrack(factory, proc, clear, trackName)
+					track.effect = effect
 				}
 			} else if factory, ok := processorFactories[name]; ok {
-				args := matches[3]
+				// reusing the processor also takes the defaults
+				factory := withDefaults(name, factory)
+				if effects != nil {
+					factory = chainFactory(factory, effects, effectNames[name])
+				}
 				if proc, err := factory(args); err != nil {
 					return fmt.Errorf("cannot instantiate processor %s: %v", name, err)
 				} else {
 					if track != nil {
 						pattern = append(pattern, track)
 					}
-					track = &Track{
-						factory: factory,
-						proc:    proc,
-						clear:   clear,
-						data:    make(DataLines),
-						bpm:     bpm,
-						step:    step,
-						steps:   steps,
-					}
+					track = newTrack(factory, proc, clear, trackName)
+					track.effect = effectNames[name]
 				}
 			} else {
 				return fmt.Errorf("unknown processor: %s", name)
 			}
+		} else if matches := automationPattern.FindStringSubmatch(line); matches != nil {
+			if track == nil {
+				return fmt.Errorf("automation line without track")
+			}
+			a := AutomationLine{data: strings.TrimSpace(matches[5])}
+			if matches[3] != "" {
+				if a.low, err = parseFloat(matches[3]); err != nil {
+					return fmt.Errorf("cannot parse automation range: %s: %w", matches[3], err)
+				}
+				if a.high, err = parseFloat(matches[4]); err != nil {
+					return fmt.Errorf("cannot parse automation range: %s: %w", matches[4], err)
+				}
+				a.ranged = true
+			}
+			if matches[1] == "!" {
+				track.locks[matches[2]] = a
+			} else {
+				track.automation[matches[2]] = a
+			}
 		} else if matches := setDataPattern.FindStringSubmatch(line); matches != nil {
+			if word, ok := unknownDirective(line); ok {
+				if err := warn(fmt.Errorf("unknown directive: %s", word)); err != nil {
+					return err
+				}
+			}
 			if track == nil {
 				return fmt.Errorf("data line without track")
 			}
-			code := matches[1][0]
-			data := matches[2]
+			code, _ := utf8.DecodeRuneInString(matches[1])
+			data := strings.TrimSpace(matches[2])
+			// after code=, steps are separated by whitespace
+			if rest, ok := strings.CutPrefix(data, "="); ok {
+				data = spacedSteps(rest)
+			}
+			if m := importPattern.FindStringSubmatch(data); m != nil {
+				if data, err = importCSV(m[1], m[2]); err != nil {
+					return err
+				}
+			}
+			if data, err = expandPatternRefs(data, code, named); err != nil {
+				return err
+			}
+			if data, err = expandGenerators(data, code, slices.Concat(pattern, Pattern{track})); err != nil {
+				return err
+			}
+			if data, err = expandEuclid(data); err != nil {
+				return err
+			}
+			if err := checkChords(data); err != nil {
+				if err := warn(err); err != nil {
+					return err
+				}
+			}
 			track.data[code] = data
+			track.sources[code] = l
 		} else if emptyLinePattern.MatchString(line) {
-			if pattern != nil {
-				song = append(song, pattern)
-				pattern = nil
-				track = nil
-			}
+			endPattern()
 		}
 	}
-	if err := scanner.Err(); err != nil {
-		return err
+	current = nil
+	endPattern()
+	// data lines longer than their track are cut off
+	checked := make(map[*Track]bool)
+	for _, pattern := range song {
+		for _, t := range pattern {
+			if checked[t] {
+				continue
+			}
+			checked[t] = true
+			for _, code := range t.dataCodes() {
+				if width := t.dataWidth(code); width > t.steps {
+					source := t.sources[code]
+					current = &source
+					if err := warn(fmt.Errorf("%c line has %d steps, more than the %d of the track", code, width, t.steps)); err != nil {
+						return err
+					}
+				}
+			}
+		}
 	}
-	if pattern != nil {
-		song = append(song, pattern)
-		pattern = nil
-		track = nil
+	current = nil
+	// an arrangement plays named patterns in its own order
+	if arrangement != nil {
+		song = nil
+		for _, name := range arrangement {
+			patterns, ok := named[name]
+			if !ok {
+				return fmt.Errorf("unknown pattern in arrangement: %s", name)
+			}
+			song = append(song, patterns...)
+		}
 	}
-	songSamples := NewSampleBuffer()
+	song.silence()
+	songSamples := NewSampleBuffer(0)
 	writePos := 0
-	for _, pattern := range song {
-		samples := NewSampleBuffer()
+	plays := make(map[*Track]int) // by first track of the pattern
+	reported := make(map[*Track]bool)
+	for i, pattern := range song {
+		if len(pattern) == 0 {
+			continue
+		}
+		fill := i == len(song)-1 || len(song[i+1]) == 0 || song[i+1][0] != pattern[0]
+		for _, track := range pattern {
+			track.play, track.fill = plays[pattern[0]], fill
+		}
+		plays[pattern[0]]++
 		patternFrames := 0
 		for _, track := range pattern {
-			if track.clear {
-				samples.Clear()
-			}
-			track.Process(samples)
 			trackFrames := track.Frames()
 			if trackFrames > patternFrames {
 				patternFrames = trackFrames
 			}
 		}
-		songSamples = slices.Grow(songSamples, len(samples))
-		for i := 0; i < len(samples); i++ {
+		if err := pattern.checkRefs(); err != nil {
+			return err
+		}
+		pattern = pattern.fit(patternFrames)
+		// patterns are mixed overlapping so that their tails ring on
+		renderFrames := patternFrames + patternTail*int(sr)
+		samples := NewSampleBuffer(renderFrames)
+		NewMix(pattern, renderFrames).Render(samples)
+		// data lines which the processor didn't read have no effect
+		for _, t := range song[i] {
+			if t.silent || reported[t] {
+				continue
+			}
+			reported[t] = true
+			for _, code := range t.unusedCodes() {
+				source := t.sources[code]
+				current = &source
+				if err := warn(fmt.Errorf("%c line not used by the processor", code)); err != nil {
+					return err
+				}
+			}
+			current = nil
+		}
+		if end := writePos + len(samples); end > len(songSamples) {
+			songSamples = append(songSamples, make(SampleBuffer, end-len(songSamples))...)
+		}
+		for i := range samples {
 			songSamples[writePos+i] += samples[i]
 		}
 		writePos += patternFrames * nchannels
 	}
+	// drop the end of the last tail which rounds to silence in the file
+	for len(songSamples) > writePos && slices.IndexFunc(songSamples[len(songSamples)-nchannels:], audible) == -1 {
+		songSamples = songSamples[:len(songSamples)-nchannels]
+	}
+	if limiter != nil {
+		limiter.Process(songSamples)
+	}
 	filenameExt := filepath.Ext(filename)
 	outputFileName := strings.TrimSuffix(filename, filenameExt) + ".wav"
 	if err := writeWav(outputFileName, songSamples); err != nil {
@@ -242,6 +1316,12 @@ func processFile(filename string) error {
 	return nil
 }
 
+// audible reports whether a sample is louder than the least significant
+// bit of the wav file
+func audible(x float64) bool {
+	return int(x*32767) != 0
+}
+
 func writeWav(filename string, samples []float64) error {
 	bitDepth := 16
 	intBuffer := &audio.IntBuffer{
@@ -253,7 +1333,7 @@ func writeWav(filename string, samples []float64) error {
 		SourceBitDepth: bitDepth,
 	}
 	for i := 0; i < len(samples); i++ {
-		intBuffer.Data[i] = int(samples[i] * 32767)
+		intBuffer.Data[i] = int(min(max(samples[i], -1), 1) * 32767)
 	}
 	out, err := os.Create(filename)
 	if err != nil {
@@ -276,13 +1356,17 @@ func main() {
 		flag.PrintDefaults()
 		os.Exit(0)
 	}
+	flag.BoolVar(&naiveOscillators, "naive", false, "render oscillators without band-limiting")
+	flag.StringVar(&muteNames, "mute", "", "comma-separated names of tracks to mute")
+	flag.StringVar(&soloNames, "solo", "", "comma-separated names of tracks to solo")
+	flag.BoolVar(&strictMode, "strict", false, "treat problems in song files as errors rather than warnings")
 	flag.Parse()
 	if flag.NArg() == 0 {
 		flag.Usage()
 	} else {
 		for _, filename := range flag.Args() {
 			if err := processFile(filename); err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to process file %s: %v", filename, err)
+				fmt.Fprintf(os.Stderr, "Failed to process file %s: %v\n", filename, err)
 				os.Exit(1)
 			}
 		}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testTrack returns a track without a processor, seeded the same way
+// in every test
+func testTrack() *Track {
+	seeds = rand.New(rand.NewSource(1))
+	return newTrack(nil, nil, true, "")
+}
+
+// writeSong writes a song file into a temporary directory
+func writeSong(t *testing.T, song string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "song.tt")
+	if err := os.WriteFile(filename, []byte(song), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+// renderSong processes a song file and returns the wav file written
+func renderSong(t *testing.T, song string) []byte {
+	t.Helper()
+	filename := writeSong(t, song)
+	if err := processFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	wav, err := os.ReadFile(strings.TrimSuffix(filename, ".tt") + ".wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wav
+}
+
+func TestTrackStepsRepeat(t *testing.T) {
+	repeated := renderSong(t, ":kick\nsteps 4\nx...\n:hat\nx...............\n")
+	written := renderSong(t, ":kick\nx...x...x...x...\n:hat\nx...............\n")
+	if !bytes.Equal(repeated, written) {
+		t.Error("a track of 4 steps doesn't repeat over the pattern")
+	}
+}
+
+func TestRejectNonPositiveSteps(t *testing.T) {
+	for _, song := range []string{
+		"steps 0\n:kick\nx...\n",
+		":kick\nsteps -2\nx...\n",
+		"step 0\n:kick\nx...\n",
+		":kick\nstep -1\nx...\n",
+	} {
+		err := processFile(writeSong(t, song))
+		if err == nil || !strings.Contains(err.Error(), "song.tt:") {
+			t.Errorf("%q: got error %v, want one with file:line", song, err)
+		}
+	}
+}
+
+func TestPatternSeparators(t *testing.T) {
+	separated := renderSong(t, ":kick\nx x...\n--\n:hat\nx ..x.\n")
+	joined := renderSong(t, ":kick\nx x...\n:hat\nx ..x.\n")
+	if bytes.Equal(separated, joined) {
+		t.Fatal("-- doesn't end the pattern")
+	}
+	for _, separator := range []string{" ", ""} {
+		song := ":kick\nx x...\n" + separator + "\n:hat\nx ..x.\n"
+		if !bytes.Equal(renderSong(t, song), separated) {
+			t.Errorf("%q line doesn't separate patterns like --", separator)
+		}
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	defaulted := renderSong(t, "defaults basic attack=0.1\n:basic\nn C4..E4..\n")
+	given := renderSong(t, ":basic:attack=0.1\nn C4..E4..\n")
+	if !bytes.Equal(defaulted, given) {
+		t.Error("defaults don't apply like the same args given on the track")
+	}
+}
+
+func TestDefaultsKeepPositionalArgs(t *testing.T) {
+	defer func() { processorDefaults = make(map[string]map[string]string) }()
+	processorDefaults = map[string]map[string]string{
+		"basic": {"attack": "0.1"},
+		"osc":   {"release": "0.3"},
+	}
+	proc, err := withDefaults("basic", basicSynthFactory)("C3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := proc.(*BasicSynth); s.note != 48 || s.adsr.Attack != 0.1 {
+		t.Errorf("basic:C3: got note %g, attack %g", s.note, s.adsr.Attack)
+	}
+	proc, err = withDefaults("basic", basicSynthFactory)("C3:0.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := proc.(*BasicSynth); s.adsr.Attack != 0.2 {
+		t.Errorf("basic:C3:0.2: got attack %g, want 0.2", s.adsr.Attack)
+	}
+	proc, err = withDefaults("osc", oscSynthFactory)("saw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := proc.(*OscSynth); s.wave != Saw || s.adsr.Release != 0.3 {
+		t.Errorf("osc:saw: got wave %v, release %g", s.wave, s.adsr.Release)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Tuning maps keys to frequencies by a Scala scale (.scl) and keyboard
+// mapping (.kbm).
+type Tuning struct {
+	cents    []float64 // pitches of the scale degrees above the first, the last one the period
+	mapping  []int     // scale degrees of the keys of a mapping period, -1 if unmapped; empty maps keys linearly
+	middle   int       // key of scale degree 0
+	octave   int       // degrees per mapping period
+	refKey   int       // key tuned to refFreq
+	refFreq  float64
+	refCents float64 // pitch of the reference key above degree 0
+}
+
+// tuning of the song, nil for 12-tone equal temperament
+var tuning *Tuning
+
+// readScalaLines returns the lines of a Scala file without comments
+func readScalaLines(filename string) ([]string, error) {
+	f, err := os.Open(songPath(filename))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); !strings.HasPrefix(line, "!") {
+			lines = append(lines, strings.TrimSpace(line))
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// parseScalaPitch parses a pitch of a Scala scale: cents if it contains
+// a period, otherwise a ratio like 3/2 or 2
+func parseScalaPitch(s string) (float64, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("missing pitch")
+	}
+	if strings.Contains(fields[0], ".") {
+		return strconv.ParseFloat(fields[0], 64)
+	}
+	ratio, err := parseFloat(fields[0])
+	if err != nil || ratio <= 0 {
+		return 0, fmt.Errorf("invalid pitch: %s", s)
+	}
+	return 1200 * math.Log2(ratio), nil
+}
+
+// loadTuning reads a Scala scale and an optional keyboard mapping;
+// without one, degree 0 is on C4 tuned as in equal temperament and the
+// degrees follow the keys.
+func loadTuning(scl, kbm string) (*Tuning, error) {
+	lines, err := readScalaLines(scl)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("%s: missing pitch count", scl)
+	}
+	count, err := strconv.Atoi(strings.Fields(lines[1] + " x")[0])
+	if err != nil || count < 1 || len(lines) < 2+count {
+		return nil, fmt.Errorf("%s: invalid pitch count: %s", scl, lines[1])
+	}
+	t := &Tuning{middle: 60, refKey: 60, refFreq: 440 * math.Pow(2, -9.0/12), octave: count}
+	for _, line := range lines[2 : 2+count] {
+		cents, err := parseScalaPitch(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", scl, err)
+		}
+		t.cents = append(t.cents, cents)
+	}
+	if kbm != "" {
+		if err := t.loadMapping(kbm); err != nil {
+			return nil, err
+		}
+	}
+	if degree, ok := t.degree(t.refKey); ok {
+		t.refCents = t.degreeCents(degree)
+	}
+	return t, nil
+}
+
+// loadMapping reads a Scala keyboard mapping
+func (t *Tuning) loadMapping(kbm string) error {
+	lines, err := readScalaLines(kbm)
+	if err != nil {
+		return err
+	}
+	var values []string
+	for _, line := range lines {
+		if line != "" {
+			values = append(values, strings.Fields(line)[0])
+		}
+	}
+	if len(values) < 7 {
+		return fmt.Errorf("%s: incomplete keyboard mapping", kbm)
+	}
+	var header [7]float64
+	for i := range header {
+		if header[i], err = strconv.ParseFloat(values[i], 64); err != nil {
+			return fmt.Errorf("%s: invalid value: %s", kbm, values[i])
+		}
+	}
+	size := int(header[0])
+	t.middle, t.refKey, t.refFreq = int(header[3]), int(header[4]), header[5]
+	t.octave = int(header[6])
+	if size > 0 && len(values) < 7+size {
+		return fmt.Errorf("%s: incomplete keyboard mapping", kbm)
+	}
+	for _, v := range values[7:min(7+size, len(values))] {
+		degree := -1
+		if v != "x" {
+			if degree, err = strconv.Atoi(v); err != nil {
+				return fmt.Errorf("%s: invalid mapping entry: %s", kbm, v)
+			}
+		}
+		t.mapping = append(t.mapping, degree)
+	}
+	return nil
+}
+
+// floorDiv returns a/b rounded down and the non-negative remainder
+func floorDiv(a, b int) (int, int) {
+	q, r := a/b, a%b
+	if r < 0 {
+		q, r = q-1, r+b
+	}
+	return q, r
+}
+
+// degree returns the scale degree of a key
+func (t *Tuning) degree(key int) (int, bool) {
+	if len(t.mapping) == 0 {
+		return key - t.middle, true
+	}
+	periods, i := floorDiv(key-t.middle, len(t.mapping))
+	if t.mapping[i] == -1 {
+		return 0, false
+	}
+	return t.mapping[i] + periods*t.octave, true
+}
+
+// degreeCents returns the pitch of a scale degree above degree 0
+func (t *Tuning) degreeCents(degree int) float64 {
+	periods, i := floorDiv(degree, len(t.cents))
+	cents := float64(periods) * t.cents[len(t.cents)-1]
+	if i > 0 {
+		cents += t.cents[i-1]
+	}
+	return cents
+}
+
+// keyCents returns the pitch of an integer key relative to the reference
+// key; unmapped keys fall back to equal temperament
+func (t *Tuning) keyCents(key int) float64 {
+	if degree, ok := t.degree(key); ok {
+		return t.degreeCents(degree) - t.refCents
+	}
+	return 100 * float64(key-t.refKey)
+}
+
+// Freq returns the frequency of a key, interpolating the pitch of
+// fractional keys between their neighbours
+func (t *Tuning) Freq(key float64) float64 {
+	k := math.Floor(key)
+	cents := t.keyCents(int(k))
+	if frac := key - k; frac > 0 {
+		cents += frac * (t.keyCents(int(k)+1) - cents)
+	}
+	return t.refFreq * math.Pow(2, cents/1200)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// data line codes of the vector position lanes
+const (
+	vectorXCode = 'X'
+	vectorYCode = 'Y'
+)
+
+// VectorSynth crossfades between four oscillators placed at the corners
+// of a square: A at (0,0), B at (1,0), C at (0,1) and D at (1,1). The
+// position defaults to x and y and can be automated by the X and Y
+// lanes.
+type VectorSynth struct {
+	waves [4]Waveform
+	x     float64
+	y     float64
+	note  float64 // key of the first note character
+	adsr  ADSR
+	gain  float64
+}
+
+func vectorSynthFactory(args string) (Processor, error) {
+	a := parseArgs(args, "waves", "x", "y", "note", "attack", "decay", "sustain", "release", "gain")
+	s := &VectorSynth{
+		x:    a.Float("x", 0.5),
+		y:    a.Float("y", 0.5),
+		note: a.Key("note", 48),
+		adsr: ADSR{
+			Attack:  a.Float("attack", 0.01),
+			Decay:   a.Float("decay", 0.1),
+			Sustain: a.Float("sustain", 0.8),
+			Release: a.Float("release", 0.2),
+		},
+		gain: a.Float("gain", 0.3),
+	}
+	waves := strings.Split(a.String("waves", "sine,saw,square,triangle"), ",")
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	if len(waves) != 4 {
+		return nil, fmt.Errorf("vector synth needs four waveforms")
+	}
+	for i, name := range waves {
+		wave, err := parseWaveform(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		s.waves[i] = wave
+	}
+	return s, nil
+}
+
+func (s *VectorSynth) Process(t *Track, buf SampleBuffer) {
+	xLane := t.Lane(vectorXCode, s.x)
+	yLane := t.Lane(vectorYCode, s.y)
+	renderNotes(buf, t.Notes(s.note), func(n Note) Voice {
+		v := &vectorVoice{
+			xLane: xLane,
+			yLane: yLane,
+			frame: n.Start,
+			freq:  noteFreq(n.Key),
+			env:   NewEnvelope(s.adsr),
+			gain:  s.gain * n.Velocity,
+		}
+		for i, wave := range s.waves {
+			v.oscs[i].wave = wave
+		}
+		return v
+	})
+}
+
+type vectorVoice struct {
+	oscs  [4]Oscillator
+	xLane *Lane
+	yLane *Lane
+	frame int
+	freq  float64
+	env   *Envelope
+	gain  float64
+}
+
+func (v *vectorVoice) Next(gate bool) (l, r float64) {
+	x, y := v.xLane.At(v.frame), v.yLane.At(v.frame)
+	v.frame++
+	weights := [4]float64{(1 - x) * (1 - y), x * (1 - y), (1 - x) * y, x * y}
+	out := 0.0
+	for i := range v.oscs {
+		out += v.oscs[i].Next(v.freq) * weights[i]
+	}
+	out *= v.env.Next(gate) * v.gain
+	return out, out
+}
+
+func (v *vectorVoice) Done() bool {
+	return v.env.Done()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Vibrato modulates the pitch of the signal by reading it from a delay
+// line swept by a sine LFO. Depth is the peak pitch deviation; the
+// modulation fades in over onset from the start of each pattern.
+type Vibrato struct {
+	period Duration // LFO period
+	depth  float64  // cents
+	onset  Duration
+	lines  [2]*DelayLine
+	phase  float64
+}
+
+func vibratoFactory(args string) (Processor, error) {
+	a := parseArgs(args, "period", "depth", "onset")
+	v := &Vibrato{
+		period: a.Duration("period", "200ms"),
+		depth:  a.Float("depth", 30),
+		onset:  a.Duration("onset", "0"),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	if v.depth < 0 || v.depth > 1200 {
+		return nil, fmt.Errorf("invalid depth value: %g", v.depth)
+	}
+	return v, nil
+}
+
+func (v *Vibrato) Process(t *Track, buf SampleBuffer) {
+	period := max(v.period.Frames(t), 1)
+	// slow sweeps are limited to a second of delay
+	depth := min(sweep(v.depth, float64(sr)/period), float64(sr))
+	size := int(2*depth) + 2
+	for c := range v.lines {
+		if v.lines[c] == nil || len(v.lines[c].buf) < size+2 {
+			v.lines[c] = NewDelayLine(size)
+		}
+	}
+	onset := v.onset.Frames(t)
+	for i := 0; i < len(buf); i += nchannels {
+		amount := 1.0
+		if frame := float64(i / nchannels); frame < onset {
+			amount = frame / onset
+		}
+		delay := 1 + depth*amount*(1+math.Sin(2*math.Pi*v.phase))
+		for c := range v.lines {
+			v.lines[c].Write(buf[i+c])
+			buf[i+c] = v.lines[c].Read(delay)
+		}
+		v.phase = math.Mod(v.phase+1/period, 1)
+	}
+}
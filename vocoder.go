@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Vocoder imposes the spectral envelope of a modulator track on a
+// carrier track: both are split into log-spaced bands and each carrier
+// band is scaled by the level of the matching modulator band.
+type Vocoder struct {
+	carrier   string
+	modulator string
+	freqs     []float64
+	res       float64
+	gain      float64
+	mfilters  []SVF
+	cfilters  [][2]SVF
+	envs      []*Follower
+}
+
+func vocoderFactory(args string) (Processor, error) {
+	a := parseArgs(args, "carrier", "modulator", "bands", "low", "high", "release", "gain")
+	v := &Vocoder{
+		carrier:   a.String("carrier", ""),
+		modulator: a.String("modulator", ""),
+		gain:      a.Float("gain", 8),
+	}
+	release := a.Float("release", 0.03)
+	bands := max(a.Int("bands", 16), 2)
+	low := a.Float("low", 100)
+	high := a.Float("high", 8000)
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	if v.carrier == "" || v.modulator == "" {
+		return nil, fmt.Errorf("vocoder needs carrier and modulator tracks")
+	}
+	ratio := math.Pow(high/low, 1/float64(bands-1))
+	for i := 0; i < bands; i++ {
+		v.freqs = append(v.freqs, low*math.Pow(ratio, float64(i)))
+	}
+	v.res = qToRes(math.Sqrt(ratio) / (ratio - 1))
+	v.mfilters = make([]SVF, bands)
+	v.cfilters = make([][2]SVF, bands)
+	for range bands {
+		v.envs = append(v.envs, NewFollower(0.005, release))
+	}
+	return v, nil
+}
+
+func (v *Vocoder) Refs() []string {
+	return []string{v.carrier, v.modulator}
+}
+
+func (v *Vocoder) Process(t *Track, buf SampleBuffer) {
+	carrier := t.Tap(v.carrier)
+	modulator := t.Tap(v.modulator)
+	// band-pass outputs peak at 1/k
+	k := 2 - 2*v.res
+	for i := 0; i < len(buf); i += nchannels {
+		m := (modulator[i] + modulator[i+1]) / 2
+		var l, r float64
+		for b, freq := range v.freqs {
+			_, mb, _ := v.mfilters[b].Process(m, freq, v.res)
+			env := v.envs[b].Next(mb * k)
+			_, cl, _ := v.cfilters[b][0].Process(carrier[i], freq, v.res)
+			_, cr, _ := v.cfilters[b][1].Process(carrier[i+1], freq, v.res)
+			l += cl * k * env
+			r += cr * k * env
+		}
+		buf[i] += l * v.gain
+		buf[i+1] += r * v.gain
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// data line code holding the wave sequence
+const waveSeqCode = 'w'
+
+// waveSeqElement is an oscillator waveform or a looped sample
+type waveSeqElement struct {
+	wave   Waveform
+	sample *Sample
+}
+
+// WaveSeq plays a sequence of waveforms and samples, switching to the
+// next element every rate steps. The order is taken from the w line
+// (indices 0-9a-z into the waves list), or the list order without it.
+// Samples are assumed to be rooted at C4.
+type WaveSeq struct {
+	elements []waveSeqElement
+	rate     float64 // length of an element in steps
+	xfade    float64 // crossfade between elements (0..1 of an element)
+	note     float64 // key of the first note character
+	adsr     ADSR
+	gain     float64
+}
+
+func waveSeqFactory(args string) (Processor, error) {
+	a := parseArgs(args, "waves", "rate", "xfade", "note", "attack", "decay", "sustain", "release", "gain")
+	s := &WaveSeq{
+		rate:  a.Float("rate", 1),
+		xfade: a.Float("xfade", 0.2),
+		note:  a.Key("note", 48),
+		adsr: ADSR{
+			Attack:  a.Float("attack", 0.01),
+			Decay:   a.Float("decay", 0.1),
+			Sustain: a.Float("sustain", 0.8),
+			Release: a.Float("release", 0.2),
+		},
+		gain: a.Float("gain", 0.3),
+	}
+	waves := a.String("waves", "sine,saw,square,triangle")
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	if s.rate <= 0 {
+		return nil, fmt.Errorf("wave sequence rate must be positive")
+	}
+	for _, name := range strings.Split(waves, ",") {
+		name = strings.TrimSpace(name)
+		if wave, ok := waveforms[name]; ok {
+			s.elements = append(s.elements, waveSeqElement{wave: wave})
+			continue
+		}
+		sample, err := loadSample(name)
+		if err != nil {
+			return nil, err
+		}
+		s.elements = append(s.elements, waveSeqElement{sample: sample})
+	}
+	return s, nil
+}
+
+// order returns the element indices of the sequence
+func (s *WaveSeq) order(t *Track) []int {
+	var order []int
+	for _, c := range []byte(t.Data(waveSeqCode)) {
+		if i := strings.IndexByte(noteChars, c); i != -1 && i < len(s.elements) {
+			order = append(order, i)
+		}
+	}
+	if len(order) == 0 {
+		for i := range s.elements {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+func (s *WaveSeq) Process(t *Track, buf SampleBuffer) {
+	order := s.order(t)
+	length := max(int(s.rate*float64(t.SamplesPerStep())), 1)
+	renderNotes(buf, t.Notes(s.note), func(n Note) Voice {
+		return &waveSeqVoice{
+			seq:    s,
+			order:  order,
+			length: length,
+			freq:   noteFreq(n.Key),
+			env:    NewEnvelope(s.adsr),
+			gain:   s.gain * n.Velocity,
+		}
+	})
+}
+
+type waveSeqVoice struct {
+	seq    *WaveSeq
+	order  []int
+	length int // frames per element
+	age    int
+	osc    Oscillator
+	pos    [2]float64 // sample positions of the current and next element
+	freq   float64
+	env    *Envelope
+	gain   float64
+}
+
+func (v *waveSeqVoice) element(e waveSeqElement, pos *float64) float64 {
+	if e.sample == nil {
+		// all oscillator elements share the phase of v.osc
+		osc := Oscillator{wave: e.wave, phase: v.osc.phase}
+		return osc.Next(v.freq)
+	}
+	frames := float64(e.sample.Frames())
+	l, r := e.sample.At(math.Mod(*pos, frames))
+	*pos += v.freq / noteFreq(60) * float64(e.sample.rate) / float64(sr)
+	return (l + r) / 2
+}
+
+func (v *waveSeqVoice) Next(gate bool) (l, r float64) {
+	index := v.age / v.length
+	into := float64(v.age%v.length) / float64(v.length)
+	if v.age%v.length == 0 {
+		v.pos = [2]float64{v.pos[1], 0}
+	}
+	v.age++
+	cur := v.seq.elements[v.order[index%len(v.order)]]
+	out := v.element(cur, &v.pos[0])
+	if fade := 1 - v.seq.xfade; v.seq.xfade > 0 && into > fade {
+		next := v.seq.elements[v.order[(index+1)%len(v.order)]]
+		mix := (into - fade) / v.seq.xfade
+		out = out*(1-mix) + v.element(next, &v.pos[1])*mix
+	}
+	v.osc.Next(v.freq)
+	out *= v.env.Next(gate) * v.gain
+	return out, out
+}
+
+func (v *waveSeqVoice) Done() bool {
+	return v.env.Done()
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Wavetable is a sequence of single-cycle waveforms of equal size.
+type Wavetable struct {
+	frames [][]float64
+}
+
+func loadWavetable(filename string, size int) (*Wavetable, error) {
+	s, err := loadSample(filename)
+	if err != nil {
+		return nil, err
+	}
+	mono := s.Mono()
+	if len(mono) == 0 {
+		return nil, fmt.Errorf("empty wavetable: %s", filename)
+	}
+	if size <= 0 || size > len(mono) {
+		size = len(mono)
+	}
+	w := &Wavetable{}
+	for i := 0; i+size <= len(mono); i += size {
+		w.frames = append(w.frames, mono[i:i+size])
+	}
+	return w, nil
+}
+
+func (w *Wavetable) lookup(frame []float64, phase float64) float64 {
+	x := phase * float64(len(frame))
+	i := int(x)
+	frac := x - float64(i)
+	a := frame[i%len(frame)]
+	b := frame[(i+1)%len(frame)]
+	return a + (b-a)*frac
+}
+
+// At returns the value at phase (0..1) of the waveform at position pos
+// (0..1, clamped) of the table, interpolating between adjacent frames.
+func (w *Wavetable) At(pos, phase float64) float64 {
+	x := min(max(pos, 0), 1) * float64(len(w.frames)-1)
+	i := int(x)
+	a := w.lookup(w.frames[i], phase)
+	if i+1 >= len(w.frames) {
+		return a
+	}
+	b := w.lookup(w.frames[i+1], phase)
+	return a + (b-a)*(x-float64(i))
+}
+
+type WavetableSynth struct {
+	table *Wavetable
+	note  float64 // key of the first note character
+	pos   float64 // table position at note start
+	scan  float64 // table positions per second
+	adsr  ADSR
+	gain  float64
+}
+
+func wavetableSynthFactory(args string) (Processor, error) {
+	a := parseArgs(args, "path", "scan", "pos", "size", "note", "attack", "decay", "sustain", "release", "gain")
+	path := a.String("path", "")
+	if path == "" {
+		return nil, fmt.Errorf("missing wavetable path")
+	}
+	s := &WavetableSynth{
+		note: a.Key("note", 60),
+		pos:  a.Float("pos", 0),
+		scan: a.Float("scan", 0),
+		adsr: ADSR{
+			Attack:  a.Float("attack", 0.005),
+			Decay:   a.Float("decay", 0.1),
+			Sustain: a.Float("sustain", 0.7),
+			Release: a.Float("release", 0.1),
+		},
+		gain: a.Float("gain", 0.3),
+	}
+	size := a.Int("size", 2048)
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	if s.pos < 0 || s.pos > 1 {
+		return nil, fmt.Errorf("invalid pos value: %g", s.pos)
+	}
+	table, err := loadWavetable(path, size)
+	if err != nil {
+		return nil, err
+	}
+	s.table = table
+	return s, nil
+}
+
+func (s *WavetableSynth) Process(t *Track, buf SampleBuffer) {
+	renderNotes(buf, t.Notes(s.note), func(n Note) Voice {
+		return &wavetableVoice{
+			synth: s,
+			freq:  noteFreq(n.Key),
+			pos:   s.pos,
+			env:   NewEnvelope(s.adsr),
+			gain:  s.gain * n.Velocity,
+		}
+	})
+}
+
+type wavetableVoice struct {
+	synth *WavetableSynth
+	freq  float64
+	phase float64
+	pos   float64
+	env   *Envelope
+	gain  float64
+}
+
+func (v *wavetableVoice) Next(gate bool) (l, r float64) {
+	out := v.synth.table.At(v.pos, v.phase) * v.env.Next(gate) * v.gain
+	v.phase += v.freq / float64(sr)
+	v.phase -= math.Floor(v.phase)
+	v.pos = min(max(v.pos+v.synth.scan/float64(sr), 0), 1)
+	return out, out
+}
+
+func (v *wavetableVoice) Done() bool {
+	return v.env.Done()
+}
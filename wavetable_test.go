@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWavetableAt(t *testing.T) {
+	w := &Wavetable{frames: [][]float64{{0, 0.5}, {1, 1}}}
+	for _, test := range []struct {
+		pos, want float64
+	}{
+		{-1, 0},
+		{0, 0},
+		{0.5, 0.5},
+		{1, 1},
+		{2, 1},
+	} {
+		if got := w.At(test.pos, 0); got != test.want {
+			t.Errorf("At(%g, 0) = %g, want %g", test.pos, got, test.want)
+		}
+	}
+}
+
+func TestWavetableFactoryRejectsPos(t *testing.T) {
+	for _, args := range []string{"path=table.wav:pos=2", "path=table.wav:pos=-1"} {
+		// the position is checked before the table is loaded
+		if _, err := wavetableSynthFactory(args); err == nil || !strings.Contains(err.Error(), "pos") {
+			t.Errorf("%s: got %v, want invalid pos error", args, err)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+// Width scales the side component of the stereo signal and optionally
+// delays the right channel by a few milliseconds (Haas effect) to widen
+// mono material.
+type Width struct {
+	width float64 // side gain: 0 = mono, 1 = unchanged
+	haas  float64 // right channel delay (seconds)
+	line  *DelayLine
+}
+
+func widthFactory(args string) (Processor, error) {
+	a := parseArgs(args, "width", "haas")
+	w := &Width{
+		width: a.Float("width", 1.5),
+		haas:  a.Float("haas", 0),
+	}
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	if w.haas > 0 {
+		w.line = NewDelayLine(int(w.haas*float64(sr)) + 1)
+	}
+	return w, nil
+}
+
+func (w *Width) Process(t *Track, buf SampleBuffer) {
+	for i := 0; i < len(buf); i += nchannels {
+		l, r := buf[i], buf[i+1]
+		if w.line != nil {
+			w.line.Write(r)
+			r = w.line.Read(w.haas * float64(sr))
+		}
+		mid := (l + r) / 2
+		side := (l - r) / 2 * w.width
+		buf[i] = mid + side
+		buf[i+1] = mid - side
+	}
+}